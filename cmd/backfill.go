@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/integration"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/shared/logging"
+	"github.com/spf13/cobra"
+)
+
+const backfillDateFormat = "2006-01-02"
+
+// backfillCmd represents the backfill command
+var backfillCmd = &cobra.Command{
+	Use:   "backfill",
+	Short: "Import historical InsightAppSec scans for a date range",
+	Long: `Imports every InsightAppSec scan completed between the --from and --to dates into Threadfix, oldest to newest,
+skipping scans that are already present in Threadfix. Scans are selected using an export configuration, by name with
+the --configuration flag, and can be limited further to InsightAppSec applications matching the --app regex. If only 
+--app is provided, all enabled export configurations are used. Progress is checkpointed, so running an interrupted 
+backfill again resumes where it stopped. Useful for recovering after Threadfix data loss.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		configurationName, _ := cmd.Flags().GetString("configuration")
+		appFilter, _ := cmd.Flags().GetString("app")
+		if configurationName == "" && appFilter == "" {
+			fmt.Println("ERROR: Must define the --configuration flag, the --app flag, or both")
+			os.Exit(1)
+		}
+
+		fromFlag, _ := cmd.Flags().GetString("from")
+		from, err := time.Parse(backfillDateFormat, fromFlag)
+		if err != nil {
+			fmt.Printf("ERROR: Invalid --from date %s; expected format YYYY-MM-DD\n", fromFlag)
+			os.Exit(1)
+		}
+
+		to := time.Now().UTC()
+		if toFlag, _ := cmd.Flags().GetString("to"); toFlag != "" {
+			to, err = time.Parse(backfillDateFormat, toFlag)
+			if err != nil {
+				fmt.Printf("ERROR: Invalid --to date %s; expected format YYYY-MM-DD\n", toFlag)
+				os.Exit(1)
+			}
+			// Include scans completed at any time on the --to date
+			to = to.Add(24*time.Hour - time.Nanosecond)
+		}
+		if to.Before(from) {
+			fmt.Println("ERROR: The --to date must not be before the --from date")
+			os.Exit(1)
+		}
+
+		var exportConfigurations []integration.ExportConfiguration
+		for _, exportConfiguration := range settingsConf.ExportConfigurations {
+			if configurationName == "" && exportConfiguration.Enabled ||
+				configurationName != "" && exportConfiguration.Name == configurationName {
+				exportConfigurations = append(exportConfigurations, exportConfiguration)
+			}
+		}
+		if len(exportConfigurations) == 0 {
+			fmt.Printf("ERROR: No export configuration found with name %s\n", configurationName)
+			os.Exit(1)
+		}
+
+		connectIntegration()
+		persist, _ := cmd.Flags().GetBool("persist")
+		integration.PersistScanFiles = persist
+
+		message := fmt.Sprintf("Backfill processing started for scans completed between %s and %s",
+			from.Format(time.RFC3339), to.Format(time.RFC3339))
+		fmt.Println(message)
+		logging.Logger.Info(message)
+
+		var numScans int
+		runUntilComplete(func() {
+			numScans, err = integration.Backfill(exportConfigurations, appFilter, from, to)
+		})
+		if err != nil {
+			fmt.Printf("Backfill incomplete; %d scan(s) submitted for upload to Threadfix\n", numScans)
+			fmt.Printf("ERROR: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Backfill complete; %d scan(s) submitted for upload to Threadfix\n", numScans)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(backfillCmd)
+
+	backfillCmd.Flags().String("from", "", "Import scans completed on or after this date (YYYY-MM-DD)")
+	backfillCmd.Flags().String("to", "", "Import scans completed on or before this date (YYYY-MM-DD); defaults to now")
+	backfillCmd.Flags().String("configuration", "", "Name of the export configuration to backfill")
+	backfillCmd.Flags().String("app", "", "Regex limiting the InsightAppSec applications to backfill by name")
+	backfillCmd.Flags().BoolP("persist", "p", false, "Create and save generated scan files to filesystem; NOTE: this is for debugging purposes")
+	backfillCmd.MarkFlagRequired("from")
+}
@@ -8,6 +8,9 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"strings"
 )
 
 // configureCmd represents the configure command
@@ -21,13 +24,13 @@ ease configuration.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		// Build configuration struct
 		settings := &integration.SettingsConf{}
-		err := viper.Unmarshal(settings)
+		err := integration.UnmarshalConfiguration(settings)
 
 		logging.Setup(
 			settingsConf.Logging.Directory,
 			settingsConf.Logging.Filename,
 			settingsConf.Logging.Level,
-			settingsConf.Logging.Stdout,)
+			settingsConf.Logging.Stdout)
 
 		if err != nil {
 			logging.Logger.Fatalf("Unable to parse configuration file, %v", err)
@@ -54,11 +57,11 @@ ease configuration.`,
 var printConfigureTimes = &cobra.Command{
 	Use:   "print",
 	Short: "Print the current configuration",
-	Long: "Print the current configuration file with defined settings to standard out.",
+	Long:  "Print the current configuration file with defined settings to standard out.",
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println("Current configuration file contents:")
 		settings := &integration.SettingsConf{}
-		err := viper.Unmarshal(settings)
+		err := integration.UnmarshalConfiguration(settings)
 		if err != nil {
 			logging.Logger.Fatalf("Unable to parse configuration file, %v", err)
 		} else {
@@ -71,7 +74,258 @@ var printConfigureTimes = &cobra.Command{
 	},
 }
 
+var validateConfigureCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate the current configuration",
+	Long: `Checks the configuration file for problems such as invalid regular expressions, an invalid cron schedule,
+incomplete severity mappings, missing Threadfix team or application names, and API keys that can not be decrypted.
+With the --live flag, connections to InsightAppSec and Threadfix are also verified along with the Threadfix 
+severities, teams, and applications referenced by the configuration. Exits with a non-zero status if any problems are 
+found.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		validationErrors := integration.ValidateConfiguration(&settingsConf)
+
+		if live, _ := cmd.Flags().GetBool("live"); live {
+			if len(validationErrors) > 0 {
+				fmt.Println("Skipping live checks until the configuration errors below are corrected")
+			} else {
+				setupIntegration()
+				validationErrors = append(validationErrors, integration.ValidateConnections(&settingsConf)...)
+			}
+		}
+
+		if len(validationErrors) > 0 {
+			fmt.Printf("Found %d problem(s) in %s:\n", len(validationErrors), viper.ConfigFileUsed())
+			for _, validationError := range validationErrors {
+				fmt.Printf("  - %s\n", validationError)
+			}
+			os.Exit(1)
+		}
+		fmt.Println("Configuration is valid")
+	},
+}
+
+var setConfigureCmd = &cobra.Command{
+	Use:   "set [setting=value]...",
+	Short: "Set configuration values without prompts",
+	Long: `Sets configuration values by their path, for example connections.threadfix.host=https://threadfix.example.com
+or "exportConfigurations.Hackazon Import.enabled=false". Lists and nested settings, such as severityMappings, accept
+a YAML or JSON value. A partial configuration document in YAML or JSON can also be applied with --patch; only the 
+settings it contains are changed. API keys are encrypted before the configuration is saved.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		settings := loadConfiguration()
+		applySettings(cmd, args, settings)
+		saveConfiguration(settings)
+	},
+}
+
+var diffConfigureCmd = &cobra.Command{
+	Use:   "diff [setting=value]...",
+	Short: "Show the changes saving the configuration would make",
+	Long: `Shows the lines of the configuration file that would change if the settings and --patch document provided, 
+which are the same as for the set command, were saved. Without any settings, shows the changes saving the current 
+configuration would make, such as writing settings under their canonical names. Nothing is saved.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		settings := loadConfiguration()
+		applySettings(cmd, args, settings)
+
+		diff, err := integration.ConfigurationDiff(settings)
+		if err != nil {
+			fmt.Printf("ERROR: Unable to compare configuration: %s\n", err)
+			os.Exit(1)
+		}
+		if diff == "" {
+			fmt.Println("No changes")
+			return
+		}
+		fmt.Print(diff)
+	},
+}
+
+var addExportConfigureCmd = &cobra.Command{
+	Use:   "add-export",
+	Short: "Add an export configuration without prompts",
+	Long: `Adds an export configuration defined by flags, or by a YAML or JSON document provided with --file using the same
+keys as the configure print command. Fails if an export configuration with the same name already exists.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		settings := loadConfiguration()
+		var exportConfiguration integration.ExportConfiguration
+
+		file, _ := cmd.Flags().GetString("file")
+		if file != "" {
+			document, err := ioutil.ReadFile(file)
+			if err == nil {
+				err = yaml.Unmarshal(document, &exportConfiguration)
+			}
+			if err != nil {
+				fmt.Printf("ERROR: Unable to read export configuration from %s: %s\n", file, err)
+				os.Exit(1)
+			}
+		}
+
+		flags := cmd.Flags()
+		if flags.Changed("name") {
+			exportConfiguration.Name, _ = flags.GetString("name")
+		}
+		if flags.Changed("application-scope") {
+			exportConfiguration.ApplicationScope, _ = flags.GetString("application-scope")
+		}
+		if flags.Changed("scan-config-filter") {
+			exportConfiguration.ScanConfigFilter, _ = flags.GetString("scan-config-filter")
+		}
+		if flags.Changed("app-query") {
+			exportConfiguration.AppQuery, _ = flags.GetString("app-query")
+		}
+		if flags.Changed("scan-query") {
+			exportConfiguration.ScanQuery, _ = flags.GetString("scan-query")
+		}
+		if flags.Changed("scan-statuses") {
+			exportConfiguration.ScanStatuses, _ = flags.GetStringSlice("scan-statuses")
+		}
+		if flags.Changed("last-scan-only") {
+			exportConfiguration.LastScanOnly, _ = flags.GetBool("last-scan-only")
+		}
+		if flags.Changed("initial-import-max-days") {
+			exportConfiguration.InitialImportMaxDays, _ = flags.GetInt("initial-import-max-days")
+		}
+		if flags.Changed("map-application-by-name") {
+			exportConfiguration.MapApplicationByName, _ = flags.GetBool("map-application-by-name")
+		}
+		if flags.Changed("threadfix-application") {
+			exportConfiguration.ThreadfixApplicationName, _ = flags.GetString("threadfix-application")
+		}
+		if flags.Changed("threadfix-team") {
+			exportConfiguration.ThreadfixTeamName, _ = flags.GetString("threadfix-team")
+		}
+		// Enabled by default unless defined by the file
+		if flags.Changed("enabled") || file == "" {
+			exportConfiguration.Enabled, _ = flags.GetBool("enabled")
+		}
+
+		if err := integration.AddExportConfiguration(settings, exportConfiguration); err != nil {
+			fmt.Printf("ERROR: %s\n", err)
+			os.Exit(1)
+		}
+		saveConfiguration(settings)
+	},
+}
+
+var removeExportConfigureCmd = &cobra.Command{
+	Use:   "remove-export",
+	Short: "Remove an export configuration without prompts",
+	Long:  "Removes the export configuration with the name provided by --name.",
+	Run: func(cmd *cobra.Command, args []string) {
+		settings := loadConfiguration()
+		name, _ := cmd.Flags().GetString("name")
+
+		if err := integration.RemoveExportConfiguration(settings, name); err != nil {
+			fmt.Printf("ERROR: %s\n", err)
+			os.Exit(1)
+		}
+		saveConfiguration(settings)
+	},
+}
+
+var syncSeveritiesConfigureCmd = &cobra.Command{
+	Use:   "sync-severities",
+	Short: "Store the Threadfix severity of each severity mapping by its int value",
+	Long: `Resolves each severity mapping, and the unmapped severity default, against the severities defined in Threadfix
+and saves the current name and threadfix_int_value of each mapping's severity, so mappings keep working when a 
+severity is renamed in Threadfix. Nothing is saved if a mapped severity does not exist in Threadfix.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		settings := loadConfiguration()
+		severities := integration.ThreadfixSeverities()
+		if len(severities) == 0 {
+			fmt.Println("ERROR: Unable to list Threadfix severities; see log for details")
+			os.Exit(1)
+		}
+
+		if err := integration.SyncSeverityMappings(settings, severities); err != nil {
+			fmt.Printf("ERROR: %s\n", err)
+			os.Exit(1)
+		}
+		saveConfiguration(settings)
+	},
+}
+
+// Apply the --patch document and setting=value arguments of the set and diff commands
+func applySettings(cmd *cobra.Command, args []string, settings *integration.SettingsConf) {
+	if patchFile, _ := cmd.Flags().GetString("patch"); patchFile != "" {
+		patch, err := ioutil.ReadFile(patchFile)
+		if err != nil {
+			fmt.Printf("ERROR: Unable to read %s: %s\n", patchFile, err)
+			os.Exit(1)
+		}
+		if err := integration.ApplyConfigurationPatch(settings, patch); err != nil {
+			fmt.Printf("ERROR: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	for _, arg := range args {
+		setting := strings.SplitN(arg, "=", 2)
+		if len(setting) != 2 {
+			fmt.Printf("ERROR: Expected setting=value, got %s\n", arg)
+			os.Exit(1)
+		}
+		if err := integration.SetConfigurationValue(settings, setting[0], setting[1]); err != nil {
+			fmt.Printf("ERROR: %s\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// Load the configuration file without environment overrides so they are never written back to the file
+func loadConfiguration() *integration.SettingsConf {
+	setupLogging()
+
+	settings := &integration.SettingsConf{}
+	if err := integration.UnmarshalConfiguration(settings); err != nil {
+		logging.Logger.Fatalf("Unable to parse configuration file, %v", err)
+	}
+	integration.Configuration = settings
+	shared.ConfigFile = viper.ConfigFileUsed()
+	return settings
+}
+
+func saveConfiguration(settings *integration.SettingsConf) {
+	if err := integration.SaveConfiguration(settings); err != nil {
+		fmt.Printf("ERROR: Failed to write configuration changes: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Configuration has been saved to %s\n", viper.ConfigFileUsed())
+}
+
 func init() {
 	rootCmd.AddCommand(configureCmd)
 	configureCmd.AddCommand(printConfigureTimes)
+	configureCmd.AddCommand(validateConfigureCmd)
+
+	configureCmd.AddCommand(setConfigureCmd)
+	configureCmd.AddCommand(diffConfigureCmd)
+	configureCmd.AddCommand(addExportConfigureCmd)
+	configureCmd.AddCommand(removeExportConfigureCmd)
+	configureCmd.AddCommand(syncSeveritiesConfigureCmd)
+
+	setConfigureCmd.Flags().String("patch", "", "YAML or JSON file with the settings to change")
+	diffConfigureCmd.Flags().String("patch", "", "YAML or JSON file with the settings to change")
+
+	addExportConfigureCmd.Flags().String("file", "", "YAML or JSON file defining the export configuration")
+	addExportConfigureCmd.Flags().String("name", "", "Name of the export configuration")
+	addExportConfigureCmd.Flags().String("application-scope", "", "Regex matching InsightAppSec applications by name")
+	addExportConfigureCmd.Flags().String("scan-config-filter", "", "Regex matching InsightAppSec scan configs by name")
+	addExportConfigureCmd.Flags().String("app-query", "", "InsightAppSec search query selecting applications; replaces the application scope")
+	addExportConfigureCmd.Flags().String("scan-query", "", "InsightAppSec search query limiting the scans of each application")
+	addExportConfigureCmd.Flags().StringSlice("scan-statuses", nil, "Statuses of the InsightAppSec scans imported; defaults to COMPLETE")
+	addExportConfigureCmd.Flags().Bool("last-scan-only", false, "Only import the most recent scan")
+	addExportConfigureCmd.Flags().Int("initial-import-max-days", 0, "Days of historical scans included in the initial import")
+	addExportConfigureCmd.Flags().Bool("map-application-by-name", false, "Import to Threadfix applications named after the InsightAppSec applications")
+	addExportConfigureCmd.Flags().String("threadfix-application", "", "Threadfix application for all scans of this configuration")
+	addExportConfigureCmd.Flags().String("threadfix-team", "", "Threadfix team of the application(s)")
+	addExportConfigureCmd.Flags().Bool("enabled", true, "Whether the export configuration is enabled")
+
+	removeExportConfigureCmd.Flags().String("name", "", "Name of the export configuration to remove")
+	removeExportConfigureCmd.MarkFlagRequired("name")
+
+	validateConfigureCmd.Flags().Bool("live", false, "Also verify connections and settings against the InsightAppSec and Threadfix APIs")
 }
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/integration"
+	"github.com/spf13/cobra"
+)
+
+// importScansCmd represents the import-scans command
+var importScansCmd = &cobra.Command{
+	Use:   "import-scans",
+	Short: "Import InsightAppSec scans by ID from a file or standard input",
+	Long: `Imports many InsightAppSec scans by ID into Threadfix. Scan IDs are read from the file provided with --file, or
+from standard input when no file (or "-") is provided. Input may be CSV with one "scan_id[,team,app]" entry per line,
+or JSON as an array of {"scan_id": "...", "team": "...", "app": "..."} objects. The team and application default to
+the --team and --app flags when not provided for an entry. Scans are converted with the settings of the export
+configuration named by --configuration, or with the default redaction of credential headers when none is named. Each
+scan is reported as imported or failed, and a failure never stops the remaining scans from being imported.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var input io.Reader = os.Stdin
+		if file, _ := cmd.Flags().GetString("file"); file != "" && file != "-" {
+			f, err := os.Open(file)
+			if err != nil {
+				fmt.Printf("ERROR: Unable to open %s: %s\n", file, err)
+				os.Exit(1)
+			}
+			defer f.Close()
+			input = f
+		}
+
+		configurationName, _ := cmd.Flags().GetString("configuration")
+		exportConfiguration, err := integration.ScanImportConfiguration(settingsConf.ExportConfigurations,
+			configurationName)
+		if err != nil {
+			fmt.Printf("ERROR: %s\n", err)
+			os.Exit(1)
+		}
+
+		format, _ := cmd.Flags().GetString("format")
+		requests, err := integration.ParseScanImportRequests(input, format)
+		if err != nil {
+			fmt.Printf("ERROR: %s\n", err)
+			os.Exit(1)
+		}
+
+		connectIntegration()
+		persist, _ := cmd.Flags().GetBool("persist")
+		integration.PersistScanFiles = persist
+
+		team, _ := cmd.Flags().GetString("team")
+		app, _ := cmd.Flags().GetString("app")
+
+		var results []integration.ScanImportResult
+		runUntilComplete(func() {
+			results = integration.BulkImportScans(requests, team, app, exportConfiguration)
+		})
+
+		var failures int
+		for _, result := range results {
+			if result.Error != nil {
+				failures++
+				fmt.Printf("FAILED    %s: %s\n", result.Request.ScanID, result.Error)
+			} else {
+				fmt.Printf("IMPORTED  %s -> %s (Team: %s)\n", result.Request.ScanID, result.Request.App,
+					result.Request.Team)
+			}
+		}
+		fmt.Printf("%d of %d scan(s) imported, %d failed\n", len(results)-failures, len(results), failures)
+
+		if failures > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(importScansCmd)
+
+	importScansCmd.Flags().StringP("file", "f", "", "CSV or JSON file of scan IDs to import; reads standard input when omitted or \"-\"")
+	importScansCmd.Flags().String("format", "", "Input format, csv or json; detected from the input when omitted")
+	importScansCmd.Flags().String("team", "", "Default Threadfix team for scans without a team")
+	importScansCmd.Flags().String("app", "", "Default Threadfix application for scans without an application")
+	importScansCmd.Flags().String("configuration", "", "Export configuration whose redaction, filters, and other settings convert the scans")
+	importScansCmd.Flags().BoolP("persist", "p", false, "Create and save generated scan files to filesystem; NOTE: this is for debugging purposes")
+}
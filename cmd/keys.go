@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/integration"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/shared"
+	"github.com/spf13/cobra"
+)
+
+// keysCmd represents the keys command
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Manage the encryption keys protecting stored credentials",
+	Long: `Manage the encryption keys in the .enc.key file next to the configuration file, which are used to encrypt
+the API keys stored in the configuration.`,
+}
+
+var rotateKeysCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Generate a new encryption key and re-encrypt stored credentials with it",
+	Long: `Generates a new encryption key, re-encrypts every encrypted credential in the configuration with it, and saves
+the configuration, keeping a backup of the previous configuration file. Previous keys remain in the key file so values
+encrypted with them can still be decrypted; remove them with "keys prune" once they are no longer needed. Rotation is
+aborted without changes if any credential cannot be decrypted with the current keys.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		settings := loadConfiguration()
+
+		keyId, reencrypted, err := integration.RotateEncryptionKey(settings)
+		if err != nil {
+			fmt.Printf("ERROR: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Created encryption key %s\n", keyId)
+		for _, setting := range reencrypted {
+			fmt.Printf("Re-encrypted %s\n", setting)
+		}
+		saveConfiguration(settings)
+	},
+}
+
+var pruneKeysCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove encryption keys no longer used by the configuration",
+	Long: `Removes keys from the key file that are not used by any encrypted credential in the configuration. The key
+used for new values is always kept. Run after "keys rotate" once the rotated configuration is in use.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		settings := loadConfiguration()
+
+		removed, err := shared.PruneKeys(integration.EncryptionKeysInUse(settings))
+		if err != nil {
+			fmt.Printf("ERROR: Failed to prune encryption keys: %s\n", err)
+			os.Exit(1)
+		}
+		if len(removed) == 0 {
+			fmt.Println("No unused encryption keys to remove")
+			return
+		}
+		for index, keyId := range removed {
+			if keyId == "" {
+				removed[index] = "(original key)"
+			}
+		}
+		fmt.Printf("Removed encryption key(s): %s\n", strings.Join(removed, ", "))
+	},
+}
+
+var checkKeysCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Verify every encrypted credential decrypts with the available keys",
+	Long: `Attempts to decrypt every encrypted credential in the configuration and reports, for each one that fails,
+whether its encryption key is missing, the available key is not the one it was encrypted with, or the stored value is
+corrupted. Exits with a non-zero status if any credential cannot be decrypted.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		settings := loadConfiguration()
+
+		decryptErrors := integration.CheckEncryptedSettings(settings)
+		for _, decryptError := range decryptErrors {
+			fmt.Printf("FAILED  %s\n", decryptError)
+		}
+		if len(decryptErrors) > 0 {
+			os.Exit(1)
+		}
+		fmt.Println("All encrypted credentials decrypt with the available encryption keys")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(keysCmd)
+	keysCmd.AddCommand(rotateKeysCmd)
+	keysCmd.AddCommand(pruneKeysCmd)
+	keysCmd.AddCommand(checkKeysCmd)
+}
@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"github.com/go-resty/resty/v2"
 	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/insightappsec"
 	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/threadfix"
 	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/integration"
@@ -14,6 +13,8 @@ import (
 	"github.com/spf13/viper"
 	"os"
 	"os/signal"
+	"syscall"
+	"time"
 )
 
 var cfgFile string
@@ -30,39 +31,7 @@ platform`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	Run: func(cmd *cobra.Command, args []string) {
-		// Setup logging
-		logging.Setup(
-			settingsConf.Logging.Directory,
-			settingsConf.Logging.Filename,
-			settingsConf.Logging.Level,
-			settingsConf.Logging.Stdout,)
-		// Setup metrics tracking
-		metrics.Setup(
-			settingsConf.Metrics.Directory,
-			settingsConf.Metrics.Filename,
-			settingsConf.Metrics.Pretty)
-
-		var iasConfig = insightappsec.InsightAppSecConfiguration{
-			Region:   settingsConf.Connections.InsightAppSec.Region,
-			APIKey:   shared.Decrypt(settingsConf.Connections.InsightAppSec.Apikey),
-			BasePath: "https://%s.api.insight.rapid7.com/ias/v1/"}
-
-		var threadfixConfig = threadfix.ThreadfixConfiguration{
-			APIKey:   shared.Decrypt(settingsConf.Connections.Threadfix.Apikey),
-			Host:     settingsConf.Connections.Threadfix.Host,
-			Port:     settingsConf.Connections.Threadfix.Port,
-		}
-
-		var apiConfig = shared.APIConfiguration{Timeout: 180, RestyClient: resty.New()}
-		var apiClient = shared.APIClient{Config: apiConfig}
-
-		var ias = insightappsec.API{Config: iasConfig, APIClient: apiClient}
-		var threadfix = threadfix.API{Config: threadfixConfig, APIClient: apiClient}
-
-		// Inject InsightAppSec and Threadfix Clients
-		integration.IasClient = ias
-		integration.ThreadfixClient = threadfix
-		integration.SeverityMappings = settingsConf.SeverityMappings
+		connectIntegration()
 
 		if persist, _ := cmd.Flags().GetBool("persist"); persist {
 			integration.PersistScanFiles = true
@@ -83,30 +52,177 @@ platform`,
 				fmt.Println("ERROR: Must define --scan_team flag when initiating with the --scan flag")
 				os.Exit(1)
 			}
-			integration.ImportScan(scanId, app, team)
+			configurationName, _ := cmd.Flags().GetString("scan_configuration")
+			exportConfiguration, err := integration.ScanImportConfiguration(settingsConf.ExportConfigurations,
+				configurationName)
+			if err != nil {
+				fmt.Printf("ERROR: %s\n", err)
+				os.Exit(1)
+			}
+			if _, err := integration.ImportScan(scanId, app, team, exportConfiguration); err != nil {
+				fmt.Printf("ERROR: %s\n", err)
+				os.Exit(1)
+			}
 		} else if adhoc {
 			message := "Adhoc processing started"
 			fmt.Println(message)
 			logging.Logger.Info(message)
-			integration.ProcessConfigurations(settingsConf.ExportConfigurations)
+
+			runUntilComplete(func() {
+				integration.ProcessConfigurations(settingsConf.ExportConfigurations)
+			})
 		} else {
 			message := fmt.Sprintf("Intializing scheduler with cron: %s", settingsConf.InternalScheduler)
 			logging.Logger.Info(message)
 			// Set up scheduler
 			c := cron.New(
 				cron.WithLogger(cron.DefaultLogger))
-			c.AddFunc(settingsConf.InternalScheduler, func() {integration.ProcessConfigurations(settingsConf.ExportConfigurations)})
+			c.AddFunc(settingsConf.InternalScheduler, func() { integration.ProcessConfigurations(settingsConf.ExportConfigurations) })
 
 			// Run forever more until termination
 			go c.Start()
-			sig := make(chan os.Signal)
-			signal.Notify(sig, os.Interrupt, os.Kill)
-			<-sig
-			c.Stop()
+			<-shutdownSignal()
+
+			// Stop scheduling new runs and let the current run finish its in-flight upload
+			integration.RequestShutdown()
+			waitForShutdown(c.Stop().Done())
 		}
 	},
 }
 
+func setupLogging() {
+	logging.Setup(
+		settingsConf.Logging.Directory,
+		settingsConf.Logging.Filename,
+		settingsConf.Logging.Level,
+		settingsConf.Logging.Stdout)
+}
+
+// Set up logging, metrics, and the InsightAppSec and Threadfix clients from the loaded configuration
+func setupIntegration() {
+	setupLogging()
+	// Setup metrics tracking
+	metrics.Setup(
+		settingsConf.Metrics.Directory,
+		settingsConf.Metrics.Filename,
+		settingsConf.Metrics.Pretty)
+
+	// Fail before connecting rather than with authentication errors from blank credentials
+	if decryptErrors := integration.CheckEncryptedSettings(&settingsConf); len(decryptErrors) > 0 {
+		for _, decryptError := range decryptErrors {
+			logging.Logger.Errorf("Unable to decrypt %s: %s", decryptError.Setting, decryptError.Message)
+		}
+		logging.Logger.Fatalf("Unable to decrypt %d credential(s); run the keys check command for details",
+			len(decryptErrors))
+	}
+
+	iasApikey, err := shared.ResolveSecret(settingsConf.Connections.InsightAppSec.Apikey)
+	if err != nil {
+		logging.Logger.Fatalf("Unable to resolve InsightAppSec API key: %s", err)
+	}
+	threadfixApikey, err := shared.ResolveSecret(settingsConf.Connections.Threadfix.Apikey)
+	if err != nil {
+		logging.Logger.Fatalf("Unable to resolve Threadfix API key: %s", err)
+	}
+
+	var iasConfig = insightappsec.InsightAppSecConfiguration{
+		Region:      settingsConf.Connections.InsightAppSec.Region,
+		APIKey:      iasApikey,
+		BasePath:    settingsConf.Connections.InsightAppSec.BaseURL,
+		ConsolePath: settingsConf.Connections.InsightAppSec.ConsoleURL}
+
+	var threadfixConfig = threadfix.ThreadfixConfiguration{
+		APIKey:  threadfixApikey,
+		Host:    settingsConf.Connections.Threadfix.Host,
+		Port:    settingsConf.Connections.Threadfix.Port,
+		BaseURL: settingsConf.Connections.Threadfix.BaseURL,
+	}
+
+	// Separate clients as each connection has its own TLS and proxy settings
+	iasRestyClient, err := shared.NewRestyClient(integration.TransportConfiguration(
+		settingsConf.Connections.InsightAppSec.Proxy, settingsConf.Connections.InsightAppSec.TLS))
+	if err != nil {
+		logging.Logger.Fatalf("Unable to configure InsightAppSec connection: %s", err)
+	}
+	threadfixRestyClient, err := shared.NewRestyClient(integration.TransportConfiguration(
+		settingsConf.Connections.Threadfix.Proxy, settingsConf.Connections.Threadfix.TLS))
+	if err != nil {
+		logging.Logger.Fatalf("Unable to configure Threadfix connection: %s", err)
+	}
+
+	var iasApiClient = shared.APIClient{Config: shared.APIConfiguration{Timeout: 180, RestyClient: iasRestyClient}}
+	var threadfixApiClient = shared.APIClient{
+		Config: shared.APIConfiguration{Timeout: 180, RestyClient: threadfixRestyClient}}
+
+	var ias = insightappsec.API{Config: iasConfig, APIClient: iasApiClient}
+	var threadfix = threadfix.API{Config: threadfixConfig, APIClient: threadfixApiClient}
+
+	// Inject InsightAppSec and Threadfix Clients
+	integration.IasClient = ias
+	integration.ThreadfixClient = threadfix
+	integration.SeverityMappings = settingsConf.SeverityMappings
+	integration.CWEMappings = settingsConf.CWEMappings
+	integration.UnmappedSeverity = settingsConf.UnmappedSeverity
+	integration.CheckpointDirectory = settingsConf.Checkpoints.Directory
+	integration.ToolVersion = version
+}
+
+// Set up the integration, negotiate the Threadfix API version, and resolve the severity mappings, exiting when Threadfix
+// is unreachable, its API version is not supported, or a mapped severity does not exist in Threadfix
+func connectIntegration() {
+	setupIntegration()
+
+	if err := integration.NegotiateThreadfixVersion(settingsConf.Connections.Threadfix.APIVersion); err != nil {
+		logging.Logger.Fatalf("Unable to connect to Threadfix: %s", err)
+	}
+	if err := integration.ResolveSeverityMappings(); err != nil {
+		logging.Logger.Fatalf("Unable to resolve severity mappings: %s", err)
+	}
+}
+
+// Notify on interrupt or termination (e.g. container stop) so in-flight uploads can complete
+func shutdownSignal() <-chan os.Signal {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	return sig
+}
+
+// Run to completion, letting the current upload finish if interrupted or terminated
+func runUntilComplete(process func()) {
+	done := make(chan struct{})
+	go func() {
+		process()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-shutdownSignal():
+		integration.RequestShutdown()
+		waitForShutdown(done)
+	}
+}
+
+// Wait for in-progress processing to complete, exiting with an error if the configured deadline passes first
+func waitForShutdown(done <-chan struct{}) {
+	timeout := settingsConf.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = integration.DefaultShutdownTimeout
+	}
+	message := fmt.Sprintf("Shutdown signal received; waiting up to %d seconds for in-progress processing to complete",
+		timeout)
+	fmt.Println(message)
+	logging.Logger.Info(message)
+
+	select {
+	case <-done:
+		logging.Logger.Info("In-progress processing completed; shutting down")
+	case <-time.After(time.Duration(timeout) * time.Second):
+		logging.Logger.Errorf("In-progress processing did not complete within %d seconds; forcing shutdown", timeout)
+		os.Exit(1)
+	}
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
@@ -135,6 +251,7 @@ func init() {
 	rootCmd.Flags().String("scan", "", "Provide an InsightAppSec scan ID to import an individual scan to Threadfix")
 	rootCmd.Flags().String("scan_app", "", "Threadfix application for scan import; NOTE: required and only encorced when used with --scan flag")
 	rootCmd.Flags().String("scan_team", "", "Threadfix team for scan import; NOTE: required and only enforced when used with --scan flag")
+	rootCmd.Flags().String("scan_configuration", "", "Export configuration whose redaction, filters, and other settings convert the scan imported with the --scan flag")
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -158,8 +275,13 @@ func initConfig() {
 	}
 
 	// Unmarshal to struct
-	err := viper.Unmarshal(&settingsConf)
+	err := integration.UnmarshalConfiguration(&settingsConf)
 	if err != nil {
 		panic("Unable to unmarshal config")
 	}
-}
\ No newline at end of file
+
+	// Override settings from R7_IAS_TF_ environment variables
+	if err := integration.ApplyEnvironmentOverrides(&settingsConf); err != nil {
+		panic(fmt.Sprintf("Unable to apply configuration from environment: %s", err))
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"strings"
 
 	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/shared"
 	log "github.com/sirupsen/logrus"
@@ -16,6 +18,9 @@ type API struct {
 
 const UserAgent = "r7:insightappsec-threadfix-extension/1.0.1"
 
+// Returned by GetScanById when InsightAppSec has no scan with the ID
+var ErrScanNotFound = errors.New("scan not found")
+
 func (ias *API) DoSearch(searchType string, query string, index int, size int, sort string) []byte {
 	var search = SearchParameters{Type: searchType, Query: query}
 	var header = ias.FormatHeader()
@@ -29,12 +34,21 @@ func (ias *API) DoSearch(searchType string, query string, index int, size int, s
 		log.Error("Error in insightappsec/DoSearch", err)
 		return nil
 	}
+	// An error response would otherwise read as a page without results
+	if !response.IsSuccess() {
+		log.Errorf("Error in insightappsec/DoSearch: unexpected response %s from %s", response.Status(), url)
+		return nil
+	}
 	return response.Body()
 }
 
 func (ias *API) GetAppsByName(name string) []Application {
+	return ias.SearchApps(fmt.Sprintf("app.name LIKE %s", QuoteSearchValue(name)))
+}
+
+// Search for apps with an InsightAppSec search query, e.g. app.name LIKE 'Hackazon'
+func (ias *API) SearchApps(query string) []Application {
 	var searchType = AppSearchType
-	var query = fmt.Sprintf("app.name LIKE '%s'", name)
 	var index = PageIndex
 	var apps []Application
 	var cont = true
@@ -55,8 +69,12 @@ func (ias *API) GetAppsByName(name string) []Application {
 }
 
 func (ias *API) GetScansByAppId(appId string) []Scan {
+	return ias.SearchScans(fmt.Sprintf("scan.app.id=%s", QuoteSearchValue(appId)))
+}
+
+// Search for scans with an InsightAppSec search query, most recently submitted first
+func (ias *API) SearchScans(query string) []Scan {
 	var searchType = ScanSearchType
-	var query = fmt.Sprintf("scan.app.id='%s'", appId)
 	var index = PageIndex
 	var scans []Scan
 	var cont = true
@@ -76,6 +94,11 @@ func (ias *API) GetScansByAppId(appId string) []Scan {
 	return scans
 }
 
+// Quote a value for a search query, escaping backslashes and single quotes so the value cannot end the string early
+func QuoteSearchValue(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(value) + "'"
+}
+
 func (ias *API) GetScanById(scanId string) (Scan, error) {
 	var header = ias.FormatHeader()
 	var endpoint = "scans/" + scanId
@@ -89,30 +112,85 @@ func (ias *API) GetScanById(scanId string) (Scan, error) {
 		log.Error("Error in insightappsec/GetScan", err)
 		return scan, errors.New("error in insightappsec/GetScan")
 	}
+	if response.StatusCode() == http.StatusNotFound {
+		return scan, ErrScanNotFound
+	}
+	if !response.IsSuccess() {
+		return scan, fmt.Errorf("unexpected response %s from %s", response.Status(), url)
+	}
 	json.Unmarshal(response.Body(), &scan)
 	return scan, nil
 }
 
 func (ias *API) GetVulnsByScanId(scanId string) []Vulnerability {
-	var searchType = VulnSearchType
-	var query = fmt.Sprintf("vulnerability.scans.id='%s'", scanId)
 	var vulns []Vulnerability
+
+	var err = ias.ForEachVulnPage(scanId, func(page []Vulnerability) error {
+		vulns = append(vulns, page...)
+		return nil
+	})
+	if err != nil {
+		log.Error("Error in insightappsec/GetVulnsByScanId", err)
+	}
+	return vulns
+}
+
+// Page through the vulnerabilities of a scan, handing each page to process so that only a single page is held in
+// memory at a time; stops at the first error returned by process
+func (ias *API) ForEachVulnPage(scanId string, process func([]Vulnerability) error) error {
+	var searchType = VulnSearchType
+	var query = fmt.Sprintf("vulnerability.scans.id=%s", QuoteSearchValue(scanId))
 	var index = PageIndex
-	var cont = true
+	var numVulns = 0
 
-	for cont {
+	for {
 		var searchData VulnerabilitySearchResponse
 		var response = ias.DoSearch(searchType, query, index, PageSize, "")
-		json.Unmarshal(response, &searchData)
-		vulns = append(vulns, searchData.Data...)
+		if response == nil {
+			// A missing page would otherwise silently truncate the scan
+			return errors.New(fmt.Sprintf("failed to fetch page %d of vulnerabilities for scan %s", index, scanId))
+		}
+		if err := json.Unmarshal(response, &searchData); err != nil {
+			return errors.New(fmt.Sprintf("failed to read page %d of vulnerabilities for scan %s: %s", index,
+				scanId, err))
+		}
+		numVulns = numVulns + len(searchData.Data)
 
-		if searchData.Metadata.TotalData <= len(vulns) {
-			cont = false
-		} else {
-			index = index + 1
+		if err := process(searchData.Data); err != nil {
+			return err
 		}
+		// Later pages are only requested while vulnerabilities remain, so an empty page is a failed request; the
+		// first page is only empty when the scan has no vulnerabilities
+		if len(searchData.Data) == 0 && (index != PageIndex || searchData.Metadata.TotalData > 0) {
+			return errors.New(fmt.Sprintf("page %d of vulnerabilities for scan %s was empty after %d "+
+				"vulnerabilities", index, scanId, numVulns))
+		}
+		if searchData.Metadata.TotalData <= numVulns || len(searchData.Data) == 0 {
+			return nil
+		}
+		index = index + 1
 	}
-	return vulns
+}
+
+func (ias *API) GetAppById(appId string) (Application, error) {
+	var header = ias.FormatHeader()
+	var endpoint = "apps/" + appId
+	var url = ias.FormatUrl(Url{Endpoint: endpoint})
+	var method = shared.ApiMethodGet
+	var app Application
+
+	var response, err = ias.APIClient.CallAPI(url, method, nil, header)
+
+	if err != nil {
+		log.Error("Error in insightappsec/GetAppById", err)
+		return app, errors.New("error in insightappsec/GetAppById")
+	}
+	if !response.IsSuccess() {
+		return app, errors.New(fmt.Sprintf("error in insightappsec/GetAppById: unexpected response %s",
+			response.Status()))
+	}
+	json.Unmarshal(response.Body(), &app)
+	return app, nil
 }
 
 func (ias *API) GetModule(moduleId string) (Module, error) {
@@ -164,10 +242,17 @@ func (ias *API) GetScanConfigs() ([]ScanConfig, error) {
 
 		if err != nil {
 			log.Error("Error in insightappsec/GetScanConfigs", err)
-			return scanConfigs, errors.New(err.Error())
+			return nil, errors.New(err.Error())
+		}
+		// A failed page would otherwise end the list early with only the scan configs fetched so far
+		if !response.IsSuccess() {
+			return nil, errors.New(fmt.Sprintf("error in insightappsec/GetScanConfigs: unexpected response %s "+
+				"to page %d", response.Status(), index))
+		}
+		if err := json.Unmarshal(response.Body(), &scanConfigData); err != nil {
+			return nil, errors.New(fmt.Sprintf("error in insightappsec/GetScanConfigs: unable to read page %d: "+
+				"%s", index, err))
 		}
-
-		json.Unmarshal(response.Body(), &scanConfigData)
 		scanConfigs = append(scanConfigs, scanConfigData.Data...)
 
 		if scanConfigData.Metadata.TotalData <= len(scanConfigs) {
@@ -197,6 +282,46 @@ func (ias *API) GetScanConfigByID(id string) (ScanConfig, error) {
 	return scanConfig, nil
 }
 
+func (ias *API) GetAttackTemplate(id string) (AttackTemplate, error) {
+	var header = ias.FormatHeader()
+	var endpoint = "attack-templates/" + id
+	var url = ias.FormatUrl(Url{Endpoint: endpoint})
+	var method = shared.ApiMethodGet
+	var attackTemplate AttackTemplate
+
+	var response, err = ias.APIClient.CallAPI(url, method, nil, header)
+
+	if err != nil {
+		log.Error("Error in insightappsec/GetAttackTemplate", err)
+		return attackTemplate, errors.New("error in insightappsec/GetAttackTemplate")
+	}
+	if !response.IsSuccess() {
+		return attackTemplate, errors.New(fmt.Sprintf("error in insightappsec/GetAttackTemplate: unexpected "+
+			"response %s", response.Status()))
+	}
+	json.Unmarshal(response.Body(), &attackTemplate)
+	return attackTemplate, nil
+}
+
+// Verify the API is reachable and the API key is accepted
+func (ias *API) CheckConnection() error {
+	var header = ias.FormatHeader()
+	var endpoint = "apps"
+	var url = ias.FormatUrl(Url{Endpoint: endpoint, Index: PageIndex, Size: 1})
+	var method = shared.ApiMethodGet
+
+	var response, err = ias.APIClient.CallAPI(url, method, nil, header)
+
+	if err != nil {
+		log.Error("Error in insightappsec/CheckConnection", err)
+		return errors.New(err.Error())
+	}
+	if response.StatusCode() != http.StatusOK {
+		return fmt.Errorf("unexpected response %s from %s", response.Status(), url)
+	}
+	return nil
+}
+
 // TODO Retrieve vuln comments via API when it can be done in a non-intensive way; Currently would be a request per vulnerability
 func (ias *API) GetVulnComments() []string {
 	comments := []string{}
@@ -204,7 +329,7 @@ func (ias *API) GetVulnComments() []string {
 }
 
 func (ias *API) FormatUrl(url Url) string {
-	var fullUrl = fmt.Sprintf(ias.Config.BasePath, ias.Config.Region)
+	var fullUrl = BaseUrl(ias.Config.BasePath, ias.Config.Region)
 	fullUrl = fullUrl + url.Endpoint
 
 	var index int
@@ -218,6 +343,29 @@ func (ias *API) FormatUrl(url Url) string {
 	return fullUrl
 }
 
+// Resolve the API base URL from a template containing the region as {region} or %s, using the public API for the
+// region when no template is provided. Other % sequences, such as escaped characters, are left as they are.
+func BaseUrl(basePath string, region string) string {
+	if basePath == "" {
+		basePath = DefaultBasePath
+	}
+	basePath = strings.Replace(basePath, "%s", region, -1)
+	basePath = strings.Replace(basePath, RegionPlaceholder, region, -1)
+	if !strings.HasSuffix(basePath, "/") {
+		basePath = basePath + "/"
+	}
+	return basePath
+}
+
+// Link to a page of the InsightAppSec console, e.g. apps/<app ID>/scans/<scan ID>
+func (ias *API) ConsoleUrl(page string) string {
+	var consolePath = ias.Config.ConsolePath
+	if consolePath == "" {
+		consolePath = DefaultConsolePath
+	}
+	return BaseUrl(consolePath, ias.Config.Region) + "#/" + strings.TrimPrefix(page, "/")
+}
+
 func (ias *API) FormatHeader() map[string]string {
 	var header = make(map[string]string)
 	header["x-api-key"] = ias.Config.APIKey
@@ -7,3 +7,21 @@ const VulnSearchType = "VULNERABILITY"
 const PageIndex = 0
 const PageSize = 500
 const ScanDateSortDesc = "&sort=scan.submit_time,DESC"
+
+// Status of a scan that finished with all of its findings
+const ScanStatusComplete = "COMPLETE"
+
+// Statuses of scans that ended without completing; their failure reason explains why
+var EndedScanStatuses = []string{"FAILED", "CANCELED", "CANCELLED"}
+
+// API base URL template, formatted with the region code
+const DefaultBasePath = "https://%s.api.insight.rapid7.com/ias/v1/"
+
+// Console URL template, formatted with the region code; used to link back to apps, scans, and vulnerabilities
+const DefaultConsolePath = "https://%s.appsec.insight.rapid7.com/"
+
+// Placeholder replaced with the region code in a configured base URL
+const RegionPlaceholder = "{region}"
+
+// Region codes of the InsightAppSec API; https://insight.help.rapid7.com/docs/product-apis#section-supported-regions
+var SupportedRegions = []string{"us", "us2", "us3", "eu", "ca", "au", "ap"}
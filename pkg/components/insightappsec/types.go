@@ -49,6 +49,9 @@ type Vulnerability struct {
 	Status    string     `json:"status"`
 	Variances []Variance `json:"variances"`
 	Links     Links      `json:"links"`
+	// CVSS score and vector of the vulnerability
+	VulnerabilityScore float64 `json:"vulnerability_score,omitempty"`
+	VectorString       string  `json:"vector_string,omitempty"`
 }
 
 type VulnerabilitySearchResponse struct {
@@ -103,6 +106,8 @@ type Module struct {
 	ID          string `json:"id"`
 	Name        string `json:"name"`
 	Description string `json:"description"`
+	// Confidence of the module's findings, e.g. HIGH
+	Confidence string `json:"confidence,omitempty"`
 }
 
 type AttackDocumentation struct {
@@ -135,6 +140,12 @@ type ScanConfig struct {
 	Links Links `json:"links"`
 }
 
+type AttackTemplate struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
 type ScanConfigResponse struct {
 	Data     []ScanConfig `json:"data"`
 	Metadata Metadata     `json:"metadata"`
@@ -142,7 +153,10 @@ type ScanConfigResponse struct {
 }
 
 type InsightAppSecConfiguration struct {
-	Region   string
-	APIKey   string
+	Region string
+	APIKey string
+	// Base URL template of the API, see BaseUrl; defaults to DefaultBasePath
 	BasePath string
+	// Console URL template, see ConsoleUrl; defaults to DefaultConsolePath
+	ConsolePath string
 }
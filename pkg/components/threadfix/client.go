@@ -1,10 +1,12 @@
 package threadfix
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"mime/multipart"
+	"strings"
 
 	netUrl "net/url"
 
@@ -16,36 +18,119 @@ import (
 type API struct {
 	Config    ThreadfixConfiguration
 	APIClient shared.APIClient
+	// Endpoints of the API version negotiated with the server
+	Endpoints *EndpointSet
 }
 
 func (tf *API) UploadScan(appId int, scan ThreadfixScan) (UploadScanResponse, error) {
-	var endpoint = fmt.Sprintf("rest/v2.5/applications/%d/upload", appId)
-	var header = tf.FormatHeader()
-	var url = tf.FormatUrl(endpoint)
-	var uploadResponse UploadScanResponse
 	var scanJson, marshalError = json.Marshal(scan)
 
 	if marshalError != nil {
 		log.Error("Error marshaling JSON in threadfix/UploadScan", marshalError)
-		return uploadResponse, errors.New(marshalError.Error())
+		return UploadScanResponse{}, errors.New(marshalError.Error())
 	}
 
-	var response, apiError = tf.APIClient.Config.RestyClient.R().
-		SetFileReader("file", scan.ExecutiveSummary+".threadfix", bytes.NewReader(scanJson)).
-		SetContentLength(true).
-		SetHeaders(header).
-		Post(url)
+	return tf.UploadScanStream(appId, scan.ExecutiveSummary+".threadfix", func(writer io.Writer) error {
+		_, err := writer.Write(scanJson)
+		return err
+	})
+}
 
-	if apiError != nil {
-		log.Error("Error in threadfix/UploadScan", apiError)
-		return uploadResponse, errors.New(apiError.Error())
+// Upload the scan file written by write, streaming the multipart request to Threadfix as the file is written rather
+// than buffering it. The upload fails without Threadfix importing the scan when write returns an error.
+func (tf *API) UploadScanStream(appId int, fileName string, write func(io.Writer) error) (UploadScanResponse, error) {
+	var upload = tf.StartUpload(appId, fileName)
+	if err := write(upload); err != nil {
+		upload.Abort(err)
+		log.Error("Error writing scan in threadfix/UploadScanStream", err)
+		return UploadScanResponse{}, err
 	}
-	json.Unmarshal(response.Body(), &uploadResponse)
-	return uploadResponse, nil
+	return upload.Close()
+}
+
+// A scan file upload in progress; the file is streamed to Threadfix as it is written
+type ScanUpload struct {
+	bodyWriter *io.PipeWriter
+	form       *multipart.Writer
+	part       io.Writer
+	err        error
+	done       chan uploadResult
+}
+
+type uploadResult struct {
+	response UploadScanResponse
+	err      error
+}
+
+// Start uploading a scan file to a Threadfix application; the file is written to the returned upload, which must be
+// closed to complete the upload or aborted
+func (tf *API) StartUpload(appId int, fileName string) *ScanUpload {
+	var endpoint = fmt.Sprintf(tf.endpoints().Upload, appId)
+	var header = tf.FormatHeader()
+	var url = tf.FormatUrl(endpoint)
+
+	var bodyReader, bodyWriter = io.Pipe()
+	var upload = &ScanUpload{bodyWriter: bodyWriter, form: multipart.NewWriter(bodyWriter),
+		done: make(chan uploadResult, 1)}
+
+	go func() {
+		var result uploadResult
+		// Without a content length the body is streamed rather than buffered by resty
+		var response, apiError = tf.APIClient.Config.RestyClient.R().
+			SetHeaders(header).
+			SetHeader("Content-Type", upload.form.FormDataContentType()).
+			SetBody(bodyReader).
+			Post(url)
+
+		// Unblock writing when Threadfix stops reading the request early
+		bodyReader.Close()
+		if apiError != nil {
+			log.Error("Error in threadfix/UploadScan", apiError)
+			result.err = errors.New(apiError.Error())
+		} else {
+			json.Unmarshal(response.Body(), &result.response)
+		}
+		upload.done <- result
+	}()
+
+	upload.part, upload.err = upload.form.CreateFormFile("file", fileName)
+	return upload
+}
+
+func (upload *ScanUpload) Write(data []byte) (int, error) {
+	if upload.err != nil {
+		return 0, upload.err
+	}
+	var written int
+	written, upload.err = upload.part.Write(data)
+	return written, upload.err
+}
+
+// Complete the upload, returning the response from Threadfix
+func (upload *ScanUpload) Close() (UploadScanResponse, error) {
+	if upload.err == nil {
+		upload.err = upload.form.Close()
+	}
+	upload.bodyWriter.CloseWithError(upload.err)
+	var result = <-upload.done
+	if result.err == nil && upload.err != nil && upload.err != io.ErrClosedPipe {
+		result.err = upload.err
+	}
+	return result.response, result.err
+}
+
+// Abort the upload so that the partially written scan file is never imported
+func (upload *ScanUpload) Abort(err error) {
+	upload.bodyWriter.CloseWithError(err)
+	<-upload.done
 }
 
 func (tf *API) ListScans(appId int) ([]ScanMetadata, error) {
-	var endpoint = fmt.Sprintf("rest/applications/%d/scans", appId)
+	if tf.endpoints().ListScans == "" {
+		return tf.listApplicationScans(appId)
+	}
+
+	var endpoint = fmt.Sprintf(tf.endpoints().ListScans, appId)
 	var header = tf.FormatHeader()
 	var url = tf.FormatUrl(endpoint)
 	var scansResponse ListScansResponse
@@ -69,8 +154,35 @@ func (tf *API) ListScans(appId int) ([]ScanMetadata, error) {
 	return rapid7Scans, nil
 }
 
+// List scans from the application details for API versions without a scans endpoint
+func (tf *API) listApplicationScans(appId int) ([]ScanMetadata, error) {
+	var endpoint = fmt.Sprintf(tf.endpoints().Application, appId)
+	var header = tf.FormatHeader()
+	var url = tf.FormatUrl(endpoint)
+	var app Application
+	var rapid7Scans []ScanMetadata
+	var method = shared.ApiMethodGet
+
+	var response, err = tf.APIClient.CallAPI(url, method, nil, header)
+
+	if err != nil {
+		log.Error("Error in threadfix/ListScans", err)
+		return rapid7Scans, errors.New("error in threadfix/ListScans")
+	}
+	json.Unmarshal(response.Body(), &app)
+
+	for _, scan := range app.AppData.ScanStats {
+		if scan.ScannerName == ScannerSource {
+			rapid7Scans = append(rapid7Scans, ScanMetadata{ID: scan.ID, ImportTime: scan.ImportTime,
+				UpdatedDate: scan.UpdatedDate, ScannerName: scan.ScannerName, OriginalFileNames: scan.OriginalFileNames})
+		}
+	}
+	logging.Logger.Infof("Filtered scans to %s source, returning %d scans", ScannerSource, len(rapid7Scans))
+	return rapid7Scans, nil
+}
+
 func (tf *API) GetAppByName(teamName string, appName string) (Application, error) {
-	var endpoint = fmt.Sprintf("rest/applications/%s/lookup?name=%s", teamName, netUrl.QueryEscape(appName))
+	var endpoint = fmt.Sprintf(tf.endpoints().Lookup, teamName, netUrl.QueryEscape(appName))
 	var header = tf.FormatHeader()
 	var url = tf.FormatUrl(endpoint)
 	var app Application
@@ -87,6 +199,12 @@ func (tf *API) GetAppByName(teamName string, appName string) (Application, error
 }
 
 func (tf *API) FormatUrl(endpoint string) string {
+	if tf.Config.BaseURL != "" {
+		return strings.TrimSuffix(tf.Config.BaseURL, "/") + "/" + endpoint
+	}
+	if tf.Config.Port == "" {
+		return tf.Config.Host + "/threadfix/" + endpoint
+	}
 	var fullUrl = tf.Config.Host + ":" + tf.Config.Port + "/threadfix/" + endpoint
 	return fullUrl
 }
@@ -100,12 +218,17 @@ func (tf *API) FormatHeader() map[string]string {
 }
 
 func (tf *API) ListSeverities() (ListSeveritiesResponse, error) {
-	var endpoint = "rest/latest/severities"
+	var endpoint = tf.endpoints().Severities
 	var header = tf.FormatHeader()
 	var url = tf.FormatUrl(endpoint)
 	var severities ListSeveritiesResponse
 	var method = shared.ApiMethodGet
 
+	if endpoint == "" {
+		return severities, errors.New(fmt.Sprintf("severities are not supported by Threadfix API version %s",
+			tf.endpoints().Version))
+	}
+
 	var response, err = tf.APIClient.CallAPI(url, method, nil, header)
 
 	if err != nil {
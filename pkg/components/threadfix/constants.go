@@ -3,3 +3,11 @@ package threadfix
 // Threadfix constants
 const ToolVendor = "TOOL_VENDOR"
 const ScannerSource = "Rapid7 InsightAppSec"
+
+// Mapping types of standards referenced by findings
+const MappingTypeCWE = "CWE"
+const MappingTypeOWASP = "OWASP"
+const MappingTypeCAPEC = "CAPEC"
+const MappingTypeWASC = "WASC"
+const MappingTypePCI = "PCI"
+const MappingTypeNIST = "NIST"
@@ -0,0 +1,64 @@
+package threadfix
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// The scan file ends with the findings, which are written one at a time between this suffix's brackets
+var findingsSuffix = []byte(`"findings":[]}`)
+
+// Writes a Threadfix scan file one finding at a time so that the findings of a scan never need to be held in memory
+// together. The file is only valid JSON once closed.
+type ScanWriter struct {
+	writer      io.Writer
+	numFindings int
+}
+
+// Start a scan file with the scan details; any findings of the scan are ignored
+func NewScanWriter(writer io.Writer, scan ThreadfixScan) (*ScanWriter, error) {
+	scan.Findings = []Finding{}
+	var scanJson, err = json.Marshal(scan)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasSuffix(scanJson, findingsSuffix) {
+		return nil, errors.New("findings must be the last field of the Threadfix scan file")
+	}
+
+	// Leave the findings array open
+	if _, err := writer.Write(scanJson[:len(scanJson)-2]); err != nil {
+		return nil, err
+	}
+	return &ScanWriter{writer: writer}, nil
+}
+
+func (sw *ScanWriter) WriteFinding(finding Finding) error {
+	var findingJson, err = json.Marshal(finding)
+	if err != nil {
+		return err
+	}
+	if sw.numFindings > 0 {
+		if _, err := sw.writer.Write([]byte(",")); err != nil {
+			return err
+		}
+	}
+	if _, err := sw.writer.Write(findingJson); err != nil {
+		return err
+	}
+	sw.numFindings = sw.numFindings + 1
+	return nil
+}
+
+// Number of findings written to the scan file
+func (sw *ScanWriter) NumFindings() int {
+	return sw.numFindings
+}
+
+// Close the findings array and scan file
+func (sw *ScanWriter) Close() error {
+	_, err := sw.writer.Write([]byte("]}"))
+	return err
+}
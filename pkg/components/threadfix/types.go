@@ -15,10 +15,11 @@ type Links []struct {
 }
 
 type ScanMetadata struct {
-	ID          int    `json:"id"`
-	ImportTime  int    `json:"importTime"`
-	UpdatedDate int    `json:"updatedDate"`
-	ScannerName string `json:"scannerName"`
+	ID                int      `json:"id"`
+	ImportTime        int      `json:"importTime"`
+	UpdatedDate       int      `json:"updatedDate"`
+	ScannerName       string   `json:"scannerName"`
+	OriginalFileNames []string `json:"originalFileNames,omitempty"`
 }
 
 type ListScansResponse struct {
@@ -33,22 +34,23 @@ type PolicyStatus []struct {
 }
 
 type ScanStats struct {
-	ID                              int    `json:"id"`
-	ImportTime                      int    `json:"importTime"`
-	UpdatedDate                     int    `json:"updatedDate"`
-	NumberClosedVulnerabilities     int    `json:"numberClosedVulnerabilities"`
-	NumberNewVulnerabilities        int    `json:"numberNewVulnerabilities"`
-	NumberOldVulnerabilities        int    `json:"numberOldVulnerabilities"`
-	NumberResurfacedVulnerabilities int    `json:"numberResurfacedVulnerabilities"`
-	NumberTotalVulnerabilities      int    `json:"numberTotalVulnerabilities"`
-	NumberRepeatResults             int    `json:"numberRepeatResults"`
-	NumberRepeatFindings            int    `json:"numberRepeatFindings"`
-	NumberInfoVulnerabilities       int    `json:"numberInfoVulnerabilities"`
-	NumberLowVulnerabilities        int    `json:"numberLowVulnerabilities"`
-	NumberMediumVulnerabilities     int    `json:"numberMediumVulnerabilities"`
-	NumberHighVulnerabilities       int    `json:"numberHighVulnerabilities"`
-	NumberCriticalVulnerabilities   int    `json:"numberCriticalVulnerabilities"`
-	ScannerName                     string `json:"scannerName"`
+	ID                              int      `json:"id"`
+	ImportTime                      int      `json:"importTime"`
+	UpdatedDate                     int      `json:"updatedDate"`
+	NumberClosedVulnerabilities     int      `json:"numberClosedVulnerabilities"`
+	NumberNewVulnerabilities        int      `json:"numberNewVulnerabilities"`
+	NumberOldVulnerabilities        int      `json:"numberOldVulnerabilities"`
+	NumberResurfacedVulnerabilities int      `json:"numberResurfacedVulnerabilities"`
+	NumberTotalVulnerabilities      int      `json:"numberTotalVulnerabilities"`
+	NumberRepeatResults             int      `json:"numberRepeatResults"`
+	NumberRepeatFindings            int      `json:"numberRepeatFindings"`
+	NumberInfoVulnerabilities       int      `json:"numberInfoVulnerabilities"`
+	NumberLowVulnerabilities        int      `json:"numberLowVulnerabilities"`
+	NumberMediumVulnerabilities     int      `json:"numberMediumVulnerabilities"`
+	NumberHighVulnerabilities       int      `json:"numberHighVulnerabilities"`
+	NumberCriticalVulnerabilities   int      `json:"numberCriticalVulnerabilities"`
+	ScannerName                     string   `json:"scannerName"`
+	OriginalFileNames               []string `json:"originalFileNames,omitempty"`
 }
 
 type AppData struct {
@@ -91,6 +93,7 @@ type Application struct {
 type SurfaceLocation struct {
 	URL            string `json:"url"`
 	Parameter      string `json:"parameter"`
+	HTTPMethod     string `json:"httpMethod,omitempty"`
 	AttackString   string `json:"attackString,omitempty"`
 	AttackRequest  string `json:"attackRequest,omitempty"`
 	AttackResponse string `json:"attackResponse,omitempty"`
@@ -148,7 +151,10 @@ type VulnerabilitySeverity struct {
 }
 
 type ThreadfixConfiguration struct {
-	APIKey   string
-	Host     string
-	Port     string
+	APIKey string
+	Host   string
+	Port   string
+	// Full URL of the Threadfix application, e.g. https://appsec.example.com/threadfix/; takes precedence over the
+	// host and port
+	BaseURL string
 }
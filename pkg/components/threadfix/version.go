@@ -0,0 +1,166 @@
+package threadfix
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/shared"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/shared/logging"
+)
+
+// Detect the API version from the server rather than configuring it
+const APIVersionAuto = "auto"
+
+// REST endpoints of a Threadfix API version. Endpoints are formatted with the application ID, or the team and
+// escaped application name for lookups; an empty endpoint is not supported by the version.
+type EndpointSet struct {
+	Version string
+	// Endpoints requested to detect whether the server supports the version; every one must respond
+	Probes     []string
+	Upload     string
+	ListScans  string
+	Lookup     string
+	Severities string
+	// Versions without a scans endpoint list scans as part of the application
+	Application string
+}
+
+// The endpoints used before API versions were negotiated: the v2.5 upload, the unversioned scans and lookup, and the
+// latest severities. Detected first, so servers that worked with earlier releases keep the same endpoints.
+var MixedEndpoints = EndpointSet{
+	Version:    "mixed",
+	Probes:     []string{"rest/v2.5/teams", "rest/teams", "rest/latest/severities"},
+	Upload:     "rest/v2.5/applications/%d/upload",
+	ListScans:  "rest/applications/%d/scans",
+	Lookup:     "rest/applications/%s/lookup?name=%s",
+	Severities: "rest/latest/severities",
+}
+
+// The same calls under Threadfix's rest/latest prefix, which follows the newest REST API version of the server
+var LatestEndpoints = EndpointSet{
+	Version:    "latest",
+	Probes:     []string{"rest/latest/severities"},
+	Upload:     "rest/latest/applications/%d/upload",
+	ListScans:  "rest/latest/applications/%d/scans",
+	Lookup:     "rest/latest/applications/%s/lookup?name=%s",
+	Severities: "rest/latest/severities",
+}
+
+// The same calls under the rest/v2.5 prefix, the version the mixed endpoints upload to
+var V25Endpoints = EndpointSet{
+	Version:    "2.5",
+	Probes:     []string{"rest/v2.5/teams"},
+	Upload:     "rest/v2.5/applications/%d/upload",
+	ListScans:  "rest/v2.5/applications/%d/scans",
+	Lookup:     "rest/v2.5/applications/%s/lookup?name=%s",
+	Severities: "rest/v2.5/severities",
+}
+
+// The unversioned prefix the mixed endpoints use for scans and lookups, for servers without versioned endpoints. Scans
+// are read from the application details and severities are not listed.
+var LegacyEndpoints = EndpointSet{
+	Version:     "legacy",
+	Probes:      []string{"rest/teams"},
+	Upload:      "rest/applications/%d/upload",
+	Lookup:      "rest/applications/%s/lookup?name=%s",
+	Application: "rest/applications/%d",
+}
+
+// Supported API versions, newest first, in the order they are detected
+var SupportedEndpoints = []EndpointSet{MixedEndpoints, LatestEndpoints, V25Endpoints, LegacyEndpoints}
+
+// Select the endpoints for the configured API version, or detect the first version supported by the server when
+// the version is empty or auto
+func (tf *API) NegotiateVersion(version string) error {
+	if version != "" && !strings.EqualFold(version, APIVersionAuto) {
+		for index, endpoints := range SupportedEndpoints {
+			if strings.EqualFold(endpoints.Version, version) {
+				tf.Endpoints = &SupportedEndpoints[index]
+				return nil
+			}
+		}
+		return errors.New(fmt.Sprintf("unsupported Threadfix API version %s; expected one of %s", version,
+			strings.Join(SupportedVersions(), ", ")))
+	}
+
+	for index, endpoints := range SupportedEndpoints {
+		supported, err := tf.probe(endpoints)
+		if err != nil {
+			return err
+		}
+		if supported {
+			logging.Logger.Infof("Detected Threadfix API version %s", endpoints.Version)
+			tf.Endpoints = &SupportedEndpoints[index]
+			return nil
+		}
+		logging.Logger.Debugf("Threadfix API version %s not supported by server", endpoints.Version)
+	}
+	return errors.New(fmt.Sprintf("Threadfix at %s does not support any known API version (%s); verify the "+
+		"Threadfix host, port, or base URL", tf.FormatUrl(""), strings.Join(SupportedVersions(), ", ")))
+}
+
+func (tf *API) probe(endpoints EndpointSet) (bool, error) {
+	for _, endpoint := range endpoints.Probes {
+		supported, err := tf.probeEndpoint(endpoint)
+		if !supported || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (tf *API) probeEndpoint(endpoint string) (bool, error) {
+	var response, err = tf.APIClient.CallAPI(tf.FormatUrl(endpoint), shared.ApiMethodGet, nil,
+		tf.FormatHeader())
+	if err != nil {
+		return false, errors.New(fmt.Sprintf("unable to connect to Threadfix: %s", err))
+	}
+
+	switch response.StatusCode() {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusMethodNotAllowed:
+		return false, nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return false, errors.New(fmt.Sprintf("Threadfix rejected the API key (HTTP %d)", response.StatusCode()))
+	default:
+		return false, errors.New(fmt.Sprintf("unexpected response from Threadfix (HTTP %d) requesting %s",
+			response.StatusCode(), endpoint))
+	}
+
+	// Every version responds with the same envelope; anything else, such as a login page, is not the API
+	var envelope struct {
+		Success *bool  `json:"success"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(response.Body(), &envelope) != nil || envelope.Success == nil {
+		return false, nil
+	}
+	if !*envelope.Success {
+		return false, errors.New(fmt.Sprintf("Threadfix rejected the request: %s", envelope.Message))
+	}
+	return true, nil
+}
+
+func SupportedVersions() []string {
+	var versions []string
+	for _, endpoints := range SupportedEndpoints {
+		versions = append(versions, endpoints.Version)
+	}
+	return versions
+}
+
+// Whether the negotiated API version lists severities
+func (tf *API) SupportsSeverities() bool {
+	return tf.endpoints().Severities != ""
+}
+
+// Endpoints of the negotiated API version, or the mixed endpoints used before negotiation when not negotiated
+func (tf *API) endpoints() EndpointSet {
+	if tf.Endpoints == nil {
+		return MixedEndpoints
+	}
+	return *tf.Endpoints
+}
@@ -0,0 +1,29 @@
+package integration
+
+// Integration constants
+const DefaultShutdownTimeout = 300
+const DefaultCheckpointDirectory = "./state/"
+const MaxUploadAttempts = 3
+const ConfigurationBackups = 3
+
+// Upload modes of an export configuration
+const UploadModeSingle = "single"
+const UploadModeCompress = "compress"
+
+// Variance modes of an export configuration
+const VarianceModePreferred = "preferred"
+const VarianceModeFindings = "findings"
+const VarianceModeDetails = "details"
+
+// Unmapped severity policies
+const UnmappedSeverityPolicyDefault = "default"
+const UnmappedSeverityPolicySkip = "skip"
+const UnmappedSeverityPolicyFail = "fail"
+
+// Finding metadata keys
+const MetadataOriginalValue = "Original Value"
+const MetadataOriginalRequest = "Original Request"
+const MetadataOriginalResponse = "Original Response"
+const MetadataCVSSScore = "CVSS Score"
+const MetadataCVSSVector = "CVSS Vector"
+const MetadataConfidence = "Confidence"
@@ -1,32 +1,86 @@
 package integration
 
 import (
+	"archive/zip"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/insightappsec"
 	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/threadfix"
-	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/shared"
 	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/shared/logging"
 	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/shared/metrics"
+	"io"
 	"io/ioutil"
 	"os"
-	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 var SeverityMappings []SeverityMapping
+var CWEMappings []CWEMapping
+var UnmappedSeverity UnmappedSeverityConf
 var IasClient insightappsec.API
 var ThreadfixClient threadfix.API
 var PersistScanFiles bool
 
+var shutdown = make(chan struct{})
+var shutdownOnce sync.Once
+
+// Signal in-progress processing to stop once the current scan upload has completed
+func RequestShutdown() {
+	shutdownOnce.Do(func() {
+		logging.Logger.Info("Shutdown requested; no further scans will be imported during this run")
+		close(shutdown)
+	})
+}
+
+func ShutdownRequested() bool {
+	select {
+	case <-shutdown:
+		return true
+	default:
+		return false
+	}
+}
+
 func ProcessApp(threadfixApp threadfix.Application, exportConfiguration ExportConfiguration, initialImport bool) (bool, int) {
 	var numScansImported int
+	var numScansResumed int
 	var err error
+
+	// Resume an import interrupted during a previous run before looking for new scans
+	checkpoint, err := LoadCheckpoint(exportConfiguration.Name, threadfixApp.AppData.ID)
+	if err != nil {
+		logging.Logger.Errorf("Failed to load checkpoint for %s Threadfix Application: %s",
+			threadfixApp.AppData.Name, err)
+		return false, 0
+	}
+
+	if checkpoint.Pending() {
+		logging.Logger.Infof("Resuming interrupted import of %d scan(s) to %s Threadfix Application",
+			len(checkpoint.RemainingScans),
+			threadfixApp.AppData.Name)
+		numScansResumed, err = ResumeScans(threadfixApp, checkpoint, exportConfiguration)
+
+		if err != nil {
+			logging.Logger.Errorf("Failed to resume import of scans to %s Threadfix Application: %s",
+				threadfixApp.AppData.Name, err)
+			return false, numScansResumed
+		}
+		if checkpoint.Pending() {
+			// Interrupted again; continue from the checkpoint on the next run
+			return true, numScansResumed
+		}
+		if numScansResumed > 0 {
+			initialImport = false
+		}
+	}
+
 	if initialImport {
-		logging.Logger.Infof("Performing initial import of scans for Threadfix App: %s; Last Scan Only: %t, " +
+		logging.Logger.Infof("Performing initial import of scans for Threadfix App: %s; Last Scan Only: %t, "+
 			"Application Scope: %s",
 			threadfixApp.AppData.Name,
 			exportConfiguration.LastScanOnly,
@@ -36,12 +90,14 @@ func ProcessApp(threadfixApp threadfix.Application, exportConfiguration ExportCo
 			exportConfiguration.LastScanOnly,
 			exportConfiguration.InitialImportMaxDays,
 			exportConfiguration.ApplicationScope,
-			exportConfiguration.ScanConfigFilter)
+			exportConfiguration.ScanConfigFilter,
+			checkpoint,
+			exportConfiguration)
 
 		if err != nil {
 			logging.Logger.Errorf("Failed during initial import of scans to %s Threadfix Application",
 				threadfixApp.AppData.Name)
-			return false, 0
+			return false, numScansResumed
 		}
 
 		logging.Logger.Infof("%d scan(s) queued during initial import to %s Threadfix Application",
@@ -56,11 +112,13 @@ func ProcessApp(threadfixApp threadfix.Application, exportConfiguration ExportCo
 		numScansImported, err = ImportScans(threadfixApp,
 			exportConfiguration.LastScanOnly,
 			exportConfiguration.ApplicationScope,
-			exportConfiguration.ScanConfigFilter)
+			exportConfiguration.ScanConfigFilter,
+			checkpoint,
+			exportConfiguration)
 
 		if err != nil {
 			logging.Logger.Errorf("Failed to import scans to %s Threadfix Application", threadfixApp.AppData.Name)
-			return false, 0
+			return false, numScansResumed
 		}
 
 		logging.Logger.Infof("%d scan(s) queued to be imported to %s Threadfix Application",
@@ -68,12 +126,12 @@ func ProcessApp(threadfixApp threadfix.Application, exportConfiguration ExportCo
 			threadfixApp.AppData.Name)
 	}
 
-	return true, numScansImported
+	return true, numScansResumed + numScansImported
 }
 
 func ProcessConfiguration(exportConfiguration ExportConfiguration) bool {
 	// Get InsightAppSec Apps by Name
-	var insightappsecApps = IasClient.GetAppsByName(exportConfiguration.ApplicationScope)
+	var insightappsecApps = scopedApps(exportConfiguration.ApplicationScope, exportConfiguration)
 	logging.Logger.Debugf("Number of apps returned for search: %v\n", len(insightappsecApps))
 
 	if exportConfiguration.MapApplicationByName {
@@ -82,6 +140,11 @@ func ProcessConfiguration(exportConfiguration ExportConfiguration) bool {
 
 		// Process app name == app name
 		for _, insightappsecApp := range insightappsecApps {
+			if ShutdownRequested() {
+				logging.Logger.Infof("Skipping remaining applications for export configuration %s due to shutdown",
+					exportConfiguration.Name)
+				break
+			}
 			processStart := time.Now()
 			// Get App of Threadfix Application Name
 			threadfixApp, err := ThreadfixClient.GetAppByName(exportConfiguration.ThreadfixTeamName,
@@ -91,13 +154,13 @@ func ProcessConfiguration(exportConfiguration ExportConfiguration) bool {
 				return false
 			}
 
-			// Set Application Scope name to specific Insightappsec app name
-			exportConfiguration.ApplicationScope = insightappsecApp.Name
+			// Set Application Scope to specific Insightappsec app
+			appConfiguration := scopeToApp(exportConfiguration, insightappsecApp)
 
 			// Get Scans for Threadfix App
 			threadfixAppScans, _ := ThreadfixClient.ListScans(threadfixApp.AppData.ID)
 
-			_, numScans := ProcessApp(threadfixApp, exportConfiguration, len(threadfixAppScans) == 0)
+			_, numScans := ProcessApp(threadfixApp, appConfiguration, len(threadfixAppScans) == 0)
 
 			metrics.Metrics.
 				WithField("start_time", processStart).
@@ -143,8 +206,20 @@ func ProcessConfiguration(exportConfiguration ExportConfiguration) bool {
 	return true
 }
 
+// Select the endpoints of the configured Threadfix API version, or detect the version supported by Threadfix
+func NegotiateThreadfixVersion(version string) error {
+	return ThreadfixClient.NegotiateVersion(version)
+}
+
 func ProcessConfigurations(exportConfigurations []ExportConfiguration) {
+	ResetFilteredFindings()
+	ResetRunCache()
+	defer logFilteredFindings()
 	for _, exportConfiguration := range exportConfigurations {
+		if ShutdownRequested() {
+			logging.Logger.Info("Skipping remaining export configurations due to shutdown")
+			break
+		}
 		if exportConfiguration.Enabled {
 			logging.Logger.Info(fmt.Sprintf("Begin processing [%s] export configuration", exportConfiguration.Name))
 			ProcessConfiguration(exportConfiguration)
@@ -153,66 +228,47 @@ func ProcessConfigurations(exportConfigurations []ExportConfiguration) {
 	}
 }
 
-func ImportScan(scanId string, appName string, teamName string) (int, error) {
-	var numSubmittedScans = 0
-
+// Import an individual InsightAppSec scan by ID to a Threadfix application, converting it with the export
+// configuration's settings
+func ImportScan(scanId string, appName string, teamName string, exportConfiguration ExportConfiguration) (int, error) {
 	threadfixApp, err := ThreadfixClient.GetAppByName(teamName, appName)
 	if threadfixApp.AppData.Name == "" || err != nil {
-		fmt.Println(fmt.Sprintf("Failed to retrieve Threadfix application for App Name: %s, Team Name: %s",
+		return 0, errors.New(fmt.Sprintf("failed to retrieve Threadfix application for App Name: %s, Team Name: %s",
 			appName, teamName))
-		os.Exit(1)
 	}
 
 	scan, err := IasClient.GetScanById(scanId)
 	if scan.ID == "" || err != nil {
-		fmt.Println(fmt.Sprintf("Unable to retrieve scan by scan ID %s; verify scan ID and try again", scanId))
-		os.Exit(1)
+		return 0, errors.New(fmt.Sprintf("unable to retrieve scan by scan ID %s; verify scan ID and try again",
+			scanId))
 	}
-
-	var vulns = IasClient.GetVulnsByScanId(scanId)
-	threadfixScan := ConvertScan(scan, vulns)
-
-	// Write to filesystem for persisting scan file
-	if PersistScanFiles {
-		PersistScan(scan, threadfixScan)
+	if !scanSelected(scan, nil) {
+		return 0, errors.New(fmt.Sprintf("scan %s has status %s%s; only %s scans are imported", scanId,
+			scan.Status, failureReason(scan), insightappsec.ScanStatusComplete))
 	}
 
-	logging.Logger.Infof("Beginning Threadfix scan upload. %s", threadfixScan.ExecutiveSummary)
-	uploadStart := time.Now()
-	response, err := ThreadfixClient.UploadScan(threadfixApp.AppData.ID, threadfixScan)
-
-	if err != nil {
-		logging.Logger.Error("Error uploading scan to Threadfix in insightappsec_threadfix/ImportInitialScans", err)
-	} else {
-		if response.Success == true {
-			logging.Logger.Infof("Threadfix scan successfully submitted for upload. %s", threadfixScan.ExecutiveSummary)
-			numSubmittedScans++
-		}
+	if !UploadScan(threadfixApp, scan, exportConfiguration) {
+		return 0, errors.New(fmt.Sprintf("failed to upload scan %s to Threadfix; see log for details", scanId))
 	}
-	metrics.Metrics.
-		WithField("start_time", uploadStart).
-		WithField("end_time", time.Now()).
-		WithField("executive_summary", threadfixScan.ExecutiveSummary).
-		WithField("duration", time.Since(uploadStart).Seconds()).
-		WithField("number_of_findings", len(threadfixScan.Findings)).
-		Infof("Scan Upload")
 
-	logging.Logger.Infof("%d scans submitted for upload to Threadfix", numSubmittedScans)
-	return numSubmittedScans, nil
+	logging.Logger.Infof("1 scan submitted for upload to Threadfix")
+	return 1, nil
 }
 
-func ImportInitialScans(threadfixApp threadfix.Application, importLastScanOnly bool, importMaxDays int, appFilter string, scanConfigFilter string) (int, error) {
-	var applications = IasClient.GetAppsByName(appFilter)
+func ImportInitialScans(threadfixApp threadfix.Application, importLastScanOnly bool, importMaxDays int, appFilter string, scanConfigFilter string, checkpoint *Checkpoint, exportConfiguration ExportConfiguration) (int, error) {
+	var applications = scopedApps(appFilter, exportConfiguration)
 	var scans []insightappsec.Scan
 	var filteredScans []insightappsec.Scan
-	var numSubmittedScans = 0
 
 	// Filter by application
 	for _, app := range applications {
-		var appFilteredScans = IasClient.GetScansByAppId(app.ID)
+		var appFilteredScans = scopedScans(app.ID, exportConfiguration)
 		scans = append(scans, appFilteredScans...)
 	}
 
+	// Filter by status
+	scans = FilterByStatus(scans, exportConfiguration.ScanStatuses)
+
 	// Filter by scan config
 	scans, err := FilterByScanConfig(scans, scanConfigFilter)
 
@@ -223,7 +279,9 @@ func ImportInitialScans(threadfixApp threadfix.Application, importLastScanOnly b
 
 	// Filter by date
 	if importLastScanOnly {
-		filteredScans = append(filteredScans, scans[0]) // First scan = most recent
+		if len(scans) > 0 {
+			filteredScans = append(filteredScans, scans[0]) // First scan = most recent
+		}
 	} else {
 		var today = time.Now().UTC()
 		var subtractedDate = today.AddDate(0, 0, -importMaxDays)
@@ -232,54 +290,27 @@ func ImportInitialScans(threadfixApp threadfix.Application, importLastScanOnly b
 	}
 
 	// Convert IAS scans to Threadfix scans; process oldest to newest
-	for _, scan := range reverse(filteredScans) {
-		var vulns = IasClient.GetVulnsByScanId(scan.ID)
-		threadfixScan := ConvertScan(scan, vulns)
-
-		// Write to filesystem for persisting scan file
-		if PersistScanFiles {
-			PersistScan(scan, threadfixScan)
-		}
-
-		logging.Logger.Infof("Beginning Threadfix scan upload. %s", threadfixScan.ExecutiveSummary)
-		uploadStart := time.Now()
-		response, err := ThreadfixClient.UploadScan(threadfixApp.AppData.ID, threadfixScan)
-
-		if err != nil {
-			logging.Logger.Error("Error uploading scan to Threadfix in insightappsec_threadfix/ImportInitialScans", err)
-		} else {
-			if response.Success == true {
-				logging.Logger.Infof("Threadfix scan successfully submitted for upload. %s", threadfixScan.ExecutiveSummary)
-				numSubmittedScans++
-			} else {
-				logging.Logger.Errorf("Unsuccessful scan upload: %s", response.Message)
-			}
-		}
-		metrics.Metrics.
-			WithField("start_time", uploadStart).
-			WithField("end_time", time.Now()).
-			WithField("executive_summary", threadfixScan.ExecutiveSummary).
-			WithField("duration", time.Since(uploadStart).Seconds()).
-			WithField("number_of_findings", len(threadfixScan.Findings)).
-			Infof("Scan Upload")
+	filteredScans = reverse(filteredScans)
+	if err := checkpoint.Start(scanIds(filteredScans)); err != nil {
+		logging.Logger.Errorf("Failed to save checkpoint in insightappsec_threadfix/ImportInitialScans: %s", err)
 	}
-
-	logging.Logger.Infof("%d scans submitted for upload to Threadfix", numSubmittedScans)
-	return numSubmittedScans, nil
+	return uploadScans(threadfixApp, filteredScans, checkpoint, exportConfiguration)
 }
 
-func ImportScans(threadfixApp threadfix.Application, importLastScanOnly bool, appFilter string, scanConfigFilter string) (int, error) {
-	var applications = IasClient.GetAppsByName(appFilter)
+func ImportScans(threadfixApp threadfix.Application, importLastScanOnly bool, appFilter string, scanConfigFilter string, checkpoint *Checkpoint, exportConfiguration ExportConfiguration) (int, error) {
+	var applications = scopedApps(appFilter, exportConfiguration)
 	var scans []insightappsec.Scan
 	var filteredScans []insightappsec.Scan
-	var numSubmittedScans = 0
 
 	// Filter by application
 	for _, app := range applications {
-		var appFilteredScans = IasClient.GetScansByAppId(app.ID)
+		var appFilteredScans = scopedScans(app.ID, exportConfiguration)
 		scans = append(scans, appFilteredScans...)
 	}
 
+	// Filter by status
+	scans = FilterByStatus(scans, exportConfiguration.ScanStatuses)
+
 	// Filter by scan config
 	scans, scanConfigError := FilterByScanConfig(scans, scanConfigFilter)
 
@@ -310,61 +341,341 @@ func ImportScans(threadfixApp threadfix.Application, importLastScanOnly bool, ap
 		filteredScans = scans
 	}
 
-	// Convert InsightAppSec scans to Threadfix scans and Import
-	for _, scan := range filteredScans {
-		var vulns = IasClient.GetVulnsByScanId(scan.ID)
+	// Convert InsightAppSec scans to Threadfix scans and Import; process oldest to newest so an interrupted run
+	// never leaves older scans behind a newer one already present in Threadfix
+	filteredScans = reverse(filteredScans)
+	if err := checkpoint.Start(scanIds(filteredScans)); err != nil {
+		logging.Logger.Errorf("Failed to save checkpoint in insightappsec_threadfix/ImportScans: %s", err)
+	}
+	return uploadScans(threadfixApp, filteredScans, checkpoint, exportConfiguration)
+}
 
-		threadfixScan := ConvertScan(scan, vulns)
+// Import the scans remaining from an interrupted run, oldest to newest
+func ResumeScans(threadfixApp threadfix.Application, checkpoint *Checkpoint,
+	exportConfiguration ExportConfiguration) (int, error) {
+	var scans []insightappsec.Scan
 
-		// Write to filesystem for persisting scan file
-		if PersistScanFiles {
-			PersistScan(scan, threadfixScan)
+	for _, scanId := range checkpoint.RemainingScans {
+		// Only a scan InsightAppSec confirms no longer exists is dropped; any other failure keeps the checkpoint
+		scan, err := IasClient.GetScanById(scanId)
+		if err != nil && err != insightappsec.ErrScanNotFound {
+			return 0, errors.New(fmt.Sprintf("unable to retrieve scan %s remaining from checkpoint: %s", scanId, err))
+		}
+		if err == insightappsec.ErrScanNotFound {
+			logging.Logger.Errorf("Scan %s remaining from checkpoint no longer exists in InsightAppSec; skipping",
+				scanId)
+			if err := checkpoint.Complete(scanId, false); err != nil {
+				logging.Logger.Errorf("Failed to save checkpoint in insightappsec_threadfix/ResumeScans: %s", err)
+			}
+			continue
 		}
+		scans = append(scans, scan)
+	}
+	return uploadScans(threadfixApp, scans, checkpoint, exportConfiguration)
+}
 
-		logging.Logger.Infof("Beginning Threadfix scan upload. %s", threadfixScan.ExecutiveSummary)
-		uploadStart := time.Now()
-		response, err := ThreadfixClient.UploadScan(threadfixApp.AppData.ID, threadfixScan)
+// Convert and upload scans, ordered oldest to newest, recording progress in the checkpoint after each upload
+func uploadScans(threadfixApp threadfix.Application, scans []insightappsec.Scan, checkpoint *Checkpoint,
+	exportConfiguration ExportConfiguration) (int, error) {
+	var numSubmittedScans = 0
+	var failedScans []string
 
-		if err != nil {
-			logging.Logger.Error("Error uploading scan to Threadfix in insightappsec_threadfix/ImportScans", err)
-		} else {
-			if response.Success == true {
-				logging.Logger.Infof("Threadfix scan successfully submitted for upload. %s", threadfixScan.ExecutiveSummary)
-				numSubmittedScans++
+	for index, scan := range scans {
+		if ShutdownRequested() {
+			logging.Logger.Infof("Stopping import due to shutdown; %d scan(s) remain and will be imported "+
+				"on the next run", len(scans)-index)
+			break
+		}
+
+		if UploadScan(threadfixApp, scan, exportConfiguration) {
+			numSubmittedScans++
+			if err := checkpoint.Complete(scan.ID, true); err != nil {
+				logging.Logger.Errorf("Failed to save checkpoint in insightappsec_threadfix/uploadScans: %s", err)
 			}
+			continue
+		}
+
+		// Without a checkpoint there is no later retry, so the remaining scans are still uploaded
+		if checkpoint == nil {
+			failedScans = append(failedScans, scan.ID)
+			continue
+		}
+
+		// Later scans are held back so Threadfix always receives scans in order
+		attempts, err := checkpoint.Failed()
+		if err != nil {
+			logging.Logger.Errorf("Failed to save checkpoint in insightappsec_threadfix/uploadScans: %s", err)
+		}
+		if attempts < MaxUploadAttempts {
+			logging.Logger.Errorf("Stopping import after failed upload of scan %s (attempt %d of %d); %d scan(s) "+
+				"remain and will be retried on the next run", scan.ID, attempts, MaxUploadAttempts, len(scans)-index)
+			return numSubmittedScans, errors.New(fmt.Sprintf("failed to upload scan %s", scan.ID))
+		}
+
+		logging.Logger.Errorf("Skipping scan %s after %d failed upload attempts", scan.ID, attempts)
+		if err := checkpoint.Complete(scan.ID, false); err != nil {
+			logging.Logger.Errorf("Failed to save checkpoint in insightappsec_threadfix/uploadScans: %s", err)
 		}
-		metrics.Metrics.
-			WithField("start_time", uploadStart).
-			WithField("end_time", time.Now()).
-			WithField("executive_summary", threadfixScan.ExecutiveSummary).
-			WithField("duration", time.Since(uploadStart).Seconds()).
-			WithField("number_of_findings", len(threadfixScan.Findings)).
-			Infof("Scan Upload")
 	}
 
 	logging.Logger.Infof("%d scans submitted for upload to Threadfix", numSubmittedScans)
+	if len(failedScans) > 0 {
+		return numSubmittedScans, errors.New(fmt.Sprintf("failed to upload %d scan(s): %s", len(failedScans),
+			strings.Join(failedScans, ", ")))
+	}
 	return numSubmittedScans, nil
 }
 
+// Convert an InsightAppSec scan and upload it to a Threadfix application, returning whether it was accepted. The scan
+// is converted page by page into a temporary scan file so memory is bounded regardless of the number of
+// vulnerabilities.
+func UploadScan(threadfixApp threadfix.Application, scan insightappsec.Scan,
+	exportConfiguration ExportConfiguration) bool {
+	var uploaded = false
+	var scanIdentity = fmt.Sprintf("Application ID: %s, Scan ID: %s", scan.App.ID, scan.ID)
+
+	logging.Logger.Infof("Beginning Threadfix scan upload. %s", scanIdentity)
+	uploadStart := time.Now()
+	numFindings, err := uploadScanFile(threadfixApp.AppData.ID, scan, exportConfiguration)
+
+	if err != nil {
+		logging.Logger.Errorf("Error uploading scan to Threadfix in insightappsec_threadfix/UploadScan: %s", err)
+	} else {
+		logging.Logger.Infof("Threadfix scan successfully submitted for upload. %s", scanIdentity)
+		uploaded = true
+	}
+	metrics.Metrics.
+		WithField("start_time", uploadStart).
+		WithField("end_time", time.Now()).
+		WithField("executive_summary", scanIdentity).
+		WithField("duration", time.Since(uploadStart).Seconds()).
+		WithField("number_of_findings", numFindings).
+		Infof("Scan Upload")
+
+	return uploaded
+}
+
+// Convert a scan a page of vulnerabilities at a time, writing each finding to a temporary scan file as it is converted,
+// and upload the scan file once every page was converted. Depending on the upload mode the scan file is uploaded as
+// is or compressed. Returns the number of findings uploaded.
+func uploadScanFile(appId int, scan insightappsec.Scan, exportConfiguration ExportConfiguration) (int, error) {
+	convertStart := time.Now()
+	converter, err := newVulnerabilityConverter(exportConfiguration)
+	if err != nil {
+		return 0, err
+	}
+	var scanMetadata = converter.startScan(scan)
+	var threadfixScan = newThreadfixScan(scan, converter.scanFields, scanMetadata)
+	var file *scanFile
+	var numFindings = 0
+	var numVulnerabilities = 0
+
+	err = IasClient.ForEachVulnPage(scan.ID, func(vulnerabilities []insightappsec.Vulnerability) error {
+		numVulnerabilities = numVulnerabilities + len(vulnerabilities)
+		for _, vulnerability := range vulnerabilities {
+			findings, err := converter.convert(vulnerability)
+			if err != nil {
+				return err
+			}
+			for _, finding := range findings {
+				if file == nil {
+					if file, err = startScanFile(scan, threadfixScan, exportConfiguration.Upload); err != nil {
+						return err
+					}
+				}
+				if err := file.writer.WriteFinding(finding); err != nil {
+					return err
+				}
+				numFindings = numFindings + 1
+			}
+		}
+		return nil
+	})
+
+	// Threadfix closes every open vulnerability missing from an uploaded scan, so a scan without findings is only
+	// uploaded once every page of the complete scan was fetched
+	if err == nil && file == nil {
+		err = checkEmptyScan(scan)
+	}
+	if err == nil && file == nil {
+		logging.Logger.Infof("No findings to upload for scan ID %s of %d vulnerabilities", scan.ID,
+			numVulnerabilities)
+		file, err = startScanFile(scan, threadfixScan, exportConfiguration.Upload)
+	}
+	if err == nil {
+		err = file.finish(appId)
+		file = nil
+	}
+	if err != nil {
+		if file != nil {
+			file.abort()
+		}
+		return numFindings, err
+	}
+
+	converter.logMetrics()
+	recordFilteredFindings(exportConfiguration.Name, converter.filteredFindings)
+	if numFiltered := converter.numFilteredFindings(); numFiltered > 0 {
+		logging.Logger.Infof("%d finding(s) of scan ID %s filtered by the export configuration (%s)", numFiltered,
+			scan.ID, filteredSummary(converter.filteredFindings))
+	}
+	logging.Logger.Infof("Scan conversion for scan ID %s completed", scan.ID)
+	metrics.Metrics.
+		WithField("start_time", convertStart).
+		WithField("end_time", time.Now()).
+		WithField("duration", time.Since(convertStart).Seconds()).
+		WithField("scan_id", scan.ID).
+		WithField("number_of_findings", numFindings).
+		WithField("number_of_filtered_findings", converter.numFilteredFindings()).
+		WithField("filtered_findings", converter.filteredFindings).
+		Infof("Convert Scan")
+
+	return numFindings, nil
+}
+
+// Refuse to upload a scan without findings unless it is complete; an empty scan of an incomplete run would close
+// every open vulnerability in Threadfix. A complete scan whose vulnerabilities were all skipped or filtered is
+// uploaded, so Threadfix closes the vulnerabilities the export configuration no longer exports.
+func checkEmptyScan(scan insightappsec.Scan) error {
+	if !strings.EqualFold(scan.Status, insightappsec.ScanStatusComplete) {
+		return errors.New(fmt.Sprintf("scan %s with status %s%s has no findings; not uploading an empty scan of "+
+			"an incomplete run", scan.ID, scan.Status, failureReason(scan)))
+	}
+	return nil
+}
+
+// A scan file written to a temporary file while the scan is converted, and persisted to the filesystem when enabled.
+// It is only uploaded to Threadfix once complete, so the upload request is not held open, and subject to the Threadfix
+// timeout, while InsightAppSec is paged.
+type scanFile struct {
+	name       string
+	uploadName string
+	spool      *os.File
+	archive    *zip.Writer
+	persisted  *os.File
+	writer     *threadfix.ScanWriter
+}
+
+// Start writing the scan file of a scan
+func startScanFile(scan insightappsec.Scan, threadfixScan threadfix.ThreadfixScan, upload UploadConf) (*scanFile,
+	error) {
+	var persistedName = persistedScanFileName(scan)
+
+	var file = &scanFile{name: scanFileName(scan.ID), uploadName: scanFileName(scan.ID)}
+	spool, err := ioutil.TempFile("", file.name+"-*")
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to create temporary scan file: %s", err))
+	}
+	file.spool = spool
+
+	var writer io.Writer = spool
+	if strings.EqualFold(upload.Mode, UploadModeCompress) {
+		file.uploadName = file.name + ".zip"
+		file.archive = zip.NewWriter(spool)
+		entry, err := file.archive.Create(file.name)
+		if err != nil {
+			file.abort()
+			return nil, err
+		}
+		writer = entry
+	}
+
+	// Write to filesystem for persisting scan file
+	if PersistScanFiles {
+		persisted, err := os.OpenFile(persistedName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		if err != nil {
+			logging.Logger.Errorf("Error creating file to persist scan ID %s: %s", scan.ID, err)
+		} else {
+			file.persisted = persisted
+			writer = io.MultiWriter(writer, persisted)
+			logging.Logger.Infof("Persisting scan ID %s to filesystem: %s", scan.ID, persistedName)
+		}
+	}
+
+	scanWriter, err := threadfix.NewScanWriter(writer, threadfixScan)
+	if err != nil {
+		file.abort()
+		return nil, err
+	}
+	file.writer = scanWriter
+	return file, nil
+}
+
+// Complete the scan file and upload it to a Threadfix application, returning an error unless Threadfix accepted it
+func (file *scanFile) finish(appId int) error {
+	defer file.remove()
+
+	var err = file.writer.Close()
+	if err == nil && file.archive != nil {
+		err = file.archive.Close()
+	}
+	if file.persisted != nil {
+		file.persisted.Close()
+	}
+	if err == nil {
+		_, err = file.spool.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		return err
+	}
+
+	response, err := ThreadfixClient.UploadScanStream(appId, file.uploadName, func(writer io.Writer) error {
+		_, err := io.Copy(writer, file.spool)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if !response.Success && file.archive != nil {
+		return errors.New(fmt.Sprintf("unsuccessful upload of %s: %s; verify the Threadfix server accepts zip "+
+			"archives or set upload.mode to %s", file.uploadName, response.Message, UploadModeSingle))
+	}
+	if !response.Success {
+		return errors.New(fmt.Sprintf("unsuccessful upload of %s: %s", file.uploadName, response.Message))
+	}
+	logging.Logger.Infof("Threadfix scan file %s with %d finding(s) submitted for upload", file.uploadName,
+		file.writer.NumFindings())
+	return nil
+}
+
+// Discard the partially written scan file so it is never uploaded
+func (file *scanFile) abort() {
+	if file.persisted != nil {
+		file.persisted.Close()
+	}
+	file.remove()
+}
+
+// Remove the temporary scan file
+func (file *scanFile) remove() {
+	file.spool.Close()
+	if err := os.Remove(file.spool.Name()); err != nil {
+		logging.Logger.Errorf("Unable to remove temporary scan file %s: %s", file.spool.Name(), err)
+	}
+}
+
 // Convert InsightAppSec scan to Threadfix scan for importing
 func ConvertScan(scan insightappsec.Scan, vulnerabilities []insightappsec.Vulnerability) threadfix.ThreadfixScan {
 	convertStart := time.Now()
-	// Convert InsightAppSec Vulnerabilities to Findings
-	var findings = ConvertVulnerabilities(vulnerabilities)
+	var converter, _ = newVulnerabilityConverter(ExportConfiguration{})
+	var scanMetadata = converter.startScan(scan)
+	var threadfixScan = newThreadfixScan(scan, converter.scanFields, scanMetadata)
 
-	var created = FormatDate(scan.SubmitTime)
-	var updated = FormatDate(scan.CompletionTime)
-	var exported = FormatDate(time.Now().UTC().String())
-
-	var threadfixScan = threadfix.ThreadfixScan{
-		Created:          created,
-		Updated:          updated,
-		Exported:         exported,
-		CollectionType:   "DAST",
-		Source:           threadfix.ScannerSource,
-		ExecutiveSummary: fmt.Sprintf("Application ID: %s, Scan ID: %s", scan.App.ID, scan.ID),
-		Findings: findings,
+	// Convert InsightAppSec Vulnerabilities to Findings
+	var findings []threadfix.Finding
+	if len(vulnerabilities) == 0 {
+		logging.Logger.Info("No vulnerabilities for scan")
+	}
+	for _, vulnerability := range vulnerabilities {
+		vulnerabilityFindings, err := converter.convert(vulnerability)
+		if err != nil {
+			logging.Logger.Errorf("Error converting vulnerability: %s", err)
+			continue
+		}
+		findings = append(findings, vulnerabilityFindings...)
 	}
+	converter.logMetrics()
+	threadfixScan.Findings = findings
 
 	logging.Logger.Infof("Scan conversion for scan ID %s completed; ready for upload to Threadfix", scan.ID)
 	metrics.Metrics.
@@ -378,15 +689,28 @@ func ConvertScan(scan insightappsec.Scan, vulnerabilities []insightappsec.Vulner
 	return threadfixScan
 }
 
+// Threadfix scan details of an InsightAppSec scan, without findings
+func newThreadfixScan(scan insightappsec.Scan, fields MetadataFields,
+	metadata map[string]string) threadfix.ThreadfixScan {
+	var created = FormatDate(scan.SubmitTime)
+	var updated = FormatDate(scan.CompletionTime)
+	var exported = FormatDate(time.Now().UTC().String())
+
+	return threadfix.ThreadfixScan{
+		Created:          created,
+		Updated:          updated,
+		Exported:         exported,
+		CollectionType:   "DAST",
+		Source:           threadfix.ScannerSource,
+		ExecutiveSummary: executiveSummary(scan, fields),
+		Metadata:         metadata,
+	}
+}
+
 // Convert InsightAppSec vulnerability to a Threadfix finding while fetching attack documentation and module details
 func ConvertVulnerabilities(vulnerabilities []insightappsec.Vulnerability) []threadfix.Finding {
 	var findings []threadfix.Finding
-	modulesCache := make(map[string]insightappsec.Module)             // Used for caching
-	attackCache := make(map[string]insightappsec.AttackDocumentation) // Used for caching
-	modulesApiRequests := 0
-	modulesCacheRequests := 0
-	attackApiRequests := 0
-	attackCacheRequests := 0
+	var converter, _ = newVulnerabilityConverter(ExportConfiguration{})
 
 	if len(vulnerabilities) == 0 {
 		logging.Logger.Info("No vulnerabilities for scan")
@@ -394,109 +718,338 @@ func ConvertVulnerabilities(vulnerabilities []insightappsec.Vulnerability) []thr
 	}
 
 	for _, vulnerability := range vulnerabilities {
-		preferredVariance := PreferredVariance(vulnerability.Variances)
-		// Fetch Module details from cache or via API
-		var module insightappsec.Module
-		if val, ok := modulesCache[preferredVariance.Module.ID]; ok {
-			module = val
-			modulesCacheRequests = modulesCacheRequests + 1
-		} else {
-			module, _ = IasClient.GetModule(preferredVariance.Module.ID)
-			modulesCache[preferredVariance.Module.ID] = module
-			modulesApiRequests = modulesApiRequests + 1
-		}
-		// Fetch Attack Documentation from cache or via API
-		var attackDocumentation insightappsec.AttackDocumentation
-		key := fmt.Sprintf("%s-%s", preferredVariance.Module.ID, preferredVariance.Attack.ID)
-		if val, ok := attackCache[key]; ok {
-			attackDocumentation = val
-			attackCacheRequests = attackCacheRequests + 1
-		} else {
-			attackDocumentation, _ = IasClient.GetAttackDocumentation(preferredVariance.Module.ID, preferredVariance.Attack.ID)
-			attackCache[key] = attackDocumentation
-			attackApiRequests = attackApiRequests + 1
-		}
-
-		var attackRequest string
-		var attackResponse string
-		if len(preferredVariance.AttackExchanges) > 0 {
-			attackRequest = preferredVariance.AttackExchanges[0].Request
-			attackResponse = preferredVariance.AttackExchanges[0].Response
-		}
-
-		threadfixSeverity, err := MapSeverity(vulnerability.Severity)
-		var mappings = MapAttackDocumentation(attackDocumentation)
-
+		vulnerabilityFindings, err := converter.convert(vulnerability)
 		if err != nil {
-			logging.Logger.Errorf("Failed to map status: %s", err) // TODO: Validate what occurs when uploading scan with "Unknown" Severity
-			threadfixSeverity = "Unknown"
-		}
-
-		findings = append(findings, threadfix.Finding{
-			NativeID:              vulnerability.ID,
-			Severity:              threadfixSeverity,
-			NativeSeverity:        vulnerability.Severity,
-			Summary:               module.Name,
-			Description:           module.Description,
-			ScannerDetail:         attackDocumentation.Description,
-			ScannerRecommendation: attackDocumentation.Recommendation,
-			DynamicDetails: threadfix.DynamicDetails{
-				SurfaceLocation: threadfix.SurfaceLocation{
-					URL:            vulnerability.RootCause.URL,
-					Parameter:      vulnerability.RootCause.Parameter,
-					AttackString:   preferredVariance.AttackValue,
-					AttackRequest:  attackRequest,
-					AttackResponse: attackResponse,
-				},
-			},
-			Mappings: mappings,
-			Comments: IasClient.GetVulnComments(),
-		})
+			logging.Logger.Errorf("Error converting vulnerability: %s", err)
+			continue
+		}
+		findings = append(findings, vulnerabilityFindings...)
 	}
 
 	logging.Logger.Infof("%d InsightAppSec Vulnerabilities converted to Threadfix Findings for scan",
 		len(vulnerabilities))
-	metrics.Metrics.
-		WithField("module_cache", modulesCacheRequests).
-		WithField("module_api", modulesApiRequests).
-		WithField("attack_documentation_cache", attackCacheRequests).
-		WithField("attack_documentation_api", attackApiRequests).
-		Infof("ScanDetailsMetrics Ingestion")
+	converter.logMetrics()
 
 	return findings
 }
 
-func PreferredVariance(variances []insightappsec.Variance) insightappsec.Variance {
-	var preferredVariance insightappsec.Variance
-	prevCount := -1
+// Returned when a finding is not uploaded according to the unmapped severity policy
+var errSkipFinding = errors.New("finding skipped")
+
+// Returned when a finding is not uploaded according to the export configuration's filters
+var errFilteredFinding = errors.New("finding filtered")
+
+// Converts InsightAppSec vulnerabilities to Threadfix findings, caching module details and attack documentation
+// across the vulnerabilities of a scan
+type vulnerabilityConverter struct {
+	redactor             *Redactor
+	varianceMode         string
+	scanMetadata         *metadataTemplates
+	findingMetadata      *metadataTemplates
+	scanFields           MetadataFields
+	filter               *findingFilter
+	filteredFindings     map[string]int
+	modulesCache         map[string]insightappsec.Module
+	attackCache          map[string]insightappsec.AttackDocumentation
+	modulesApiRequests   int
+	modulesCacheRequests int
+	attackApiRequests    int
+	attackCacheRequests  int
+	skippedFindings      int
+}
+
+// Create a converter using the conversion settings of an export configuration
+func newVulnerabilityConverter(exportConfiguration ExportConfiguration) (*vulnerabilityConverter, error) {
+	redactor, err := NewRedactor(EffectiveRedaction(exportConfiguration.Redaction))
+	if err != nil {
+		return nil, err
+	}
+	scanMetadata, err := newMetadataTemplates(DefaultScanMetadata, exportConfiguration.Metadata.Scan)
+	if err != nil {
+		return nil, err
+	}
+	findingMetadata, err := newMetadataTemplates(DefaultFindingMetadata, exportConfiguration.Metadata.Finding)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := newFindingFilter(exportConfiguration.Filters)
+	if err != nil {
+		return nil, err
+	}
+	return &vulnerabilityConverter{
+		redactor:         redactor,
+		varianceMode:     strings.ToLower(exportConfiguration.Variances),
+		scanMetadata:     scanMetadata,
+		findingMetadata:  findingMetadata,
+		filter:           filter,
+		filteredFindings: make(map[string]int),
+		modulesCache:     make(map[string]insightappsec.Module),
+		attackCache:      make(map[string]insightappsec.AttackDocumentation),
+	}, nil
+}
+
+// Begin converting the vulnerabilities of a scan, fetching the fields describing it and returning its metadata
+func (converter *vulnerabilityConverter) startScan(scan insightappsec.Scan) map[string]string {
+	converter.scanFields = scanMetadataFields(scan)
+	return converter.scanMetadata.render(converter.scanFields)
+}
+
+// Convert a vulnerability to findings, recording the finding metadata on each
+func (converter *vulnerabilityConverter) convert(vulnerability insightappsec.Vulnerability) ([]threadfix.Finding,
+	error) {
+	if reason := converter.filter.filterVulnerability(vulnerability); reason != "" {
+		converter.filteredFindings[reason] = converter.filteredFindings[reason] + 1
+		return nil, nil
+	}
+	var findings, err = converter.convertVariances(vulnerability)
+	if err != nil {
+		return nil, err
+	}
+	var metadata = converter.findingMetadata.render(converter.scanFields.withVulnerability(vulnerability))
+	for index := range findings {
+		for key, value := range metadata {
+			setMetadata(&findings[index], key, value)
+		}
+	}
+	return findings, nil
+}
+
+// Convert a vulnerability to findings according to the variance mode: a finding of the preferred variance, a finding
+// for each variance, or a finding of the preferred variance detailing the others
+func (converter *vulnerabilityConverter) convertVariances(vulnerability insightappsec.Vulnerability) (
+	[]threadfix.Finding, error) {
+	var variances = SortVariances(vulnerability.Variances, func(moduleId string) string {
+		return converter.module(moduleId).Confidence
+	})
+	if len(variances) == 0 {
+		variances = []insightappsec.Variance{{}}
+	}
 
-	// Return variance with most non-nil fields; useful in identifying variance with most information to process
-	for _, variance := range variances {
-		v := reflect.ValueOf(variance)
+	if converter.varianceMode == VarianceModeFindings {
+		var findings []threadfix.Finding
+		var nativeIds = make(map[string]bool)
+		for _, variance := range variances {
+			var nativeId = VarianceNativeID(vulnerability.ID, variance)
+			// Identical variances would be the same finding
+			if nativeIds[nativeId] {
+				continue
+			}
+			nativeIds[nativeId] = true
 
-		count := 0
-		for i := 0; i < v.NumField(); i++ {
-			if v.Field(i).Interface() != "" && v.Field(i).Interface() != nil {
-				count = count + 1
+			varianceFinding, err := converter.convertVariance(vulnerability, variance)
+			if converter.omitted(err) {
+				continue
+			} else if err != nil {
+				return nil, err
 			}
+			varianceFinding.NativeID = nativeId
+			findings = append(findings, varianceFinding)
 		}
+		return findings, nil
+	}
 
-		if count > prevCount {
-			preferredVariance = variance
-			prevCount = count
+	finding, err := converter.convertVariance(vulnerability, variances[0])
+	if converter.omitted(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if converter.varianceMode == VarianceModeDetails {
+		for index, variance := range variances[1:] {
+			setMetadata(&finding, fmt.Sprintf("Variance %d", index+2), fmt.Sprintf("Module: %s; Attack: %s; "+
+				"Attack Value: %s", converter.module(variance.Module.ID).Name, variance.Attack.ID, variance.AttackValue))
 		}
 	}
-	return preferredVariance
+	return []threadfix.Finding{finding}, nil
+}
+
+func (converter *vulnerabilityConverter) convertVariance(vulnerability insightappsec.Vulnerability,
+	variance insightappsec.Variance) (threadfix.Finding, error) {
+	var module = converter.module(variance.Module.ID)
+	// Fetch Attack Documentation from cache or via API
+	var attackDocumentation insightappsec.AttackDocumentation
+	key := fmt.Sprintf("%s-%s", variance.Module.ID, variance.Attack.ID)
+	if val, ok := converter.attackCache[key]; ok {
+		attackDocumentation = val
+		converter.attackCacheRequests = converter.attackCacheRequests + 1
+	} else {
+		attackDocumentation, _ = IasClient.GetAttackDocumentation(variance.Module.ID, variance.Attack.ID)
+		converter.attackCache[key] = attackDocumentation
+		converter.attackApiRequests = converter.attackApiRequests + 1
+	}
+
+	var attackRequest string
+	var attackResponse string
+	if len(variance.AttackExchanges) > 0 {
+		attackRequest = converter.redactor.Redact(variance.AttackExchanges[0].Request)
+		attackResponse = converter.redactor.Redact(variance.AttackExchanges[0].Response)
+	}
+
+	var mappings = MapAttackDocumentation(variance.Module.ID, attackDocumentation)
+	if reason := converter.filter.filterFinding(module, mappings); reason != "" {
+		converter.filteredFindings[reason] = converter.filteredFindings[reason] + 1
+		return threadfix.Finding{}, errFilteredFinding
+	}
+	threadfixSeverity, err := unmappedSeverityPolicy(vulnerability, variance.Module.ID, mappings)
+	if err != nil {
+		return threadfix.Finding{}, err
+	}
+
+	var finding = threadfix.Finding{
+		NativeID:              vulnerability.ID,
+		Severity:              threadfixSeverity,
+		NativeSeverity:        vulnerability.Severity,
+		Summary:               module.Name,
+		Description:           module.Description,
+		ScannerDetail:         attackDocumentation.Description,
+		ScannerRecommendation: attackDocumentation.Recommendation,
+		DynamicDetails: threadfix.DynamicDetails{
+			SurfaceLocation: threadfix.SurfaceLocation{
+				URL:            vulnerability.RootCause.URL,
+				Parameter:      vulnerability.RootCause.Parameter,
+				HTTPMethod:     strings.ToUpper(vulnerability.RootCause.Method),
+				AttackString:   variance.AttackValue,
+				AttackRequest:  attackRequest,
+				AttackResponse: attackResponse,
+			},
+		},
+		Mappings: mappings,
+		Comments: IasClient.GetVulnComments(),
+	}
+
+	// The baseline exchange and value the attack was derived from, to reproduce the vulnerability
+	setMetadata(&finding, MetadataOriginalValue, variance.OriginalValue)
+	setMetadata(&finding, MetadataOriginalRequest, converter.redactor.Redact(variance.OriginalExchange.Request))
+	setMetadata(&finding, MetadataOriginalResponse, converter.redactor.Redact(variance.OriginalExchange.Response))
+
+	// Finer grained risk than the mapped severity
+	if vulnerability.VulnerabilityScore > 0 {
+		setMetadata(&finding, MetadataCVSSScore, strconv.FormatFloat(vulnerability.VulnerabilityScore, 'f', -1, 64))
+	}
+	setMetadata(&finding, MetadataCVSSVector, vulnerability.VectorString)
+	setMetadata(&finding, MetadataConfidence, module.Confidence)
+	return finding, nil
+}
+
+// Threadfix severity of a finding; findings whose severity is not mapped are given the default severity, skipped
+// with errSkipFinding, or fail the conversion according to the unmapped severity policy
+func unmappedSeverityPolicy(vulnerability insightappsec.Vulnerability, moduleId string,
+	mappings []threadfix.Mapping) (string, error) {
+	var cwe string
+	if len(mappings) > 0 && mappings[0].Primary {
+		cwe = mappings[0].Value
+	}
+	threadfixSeverity, err := MapFindingSeverity(vulnerability.Severity, moduleId, cwe)
+	if err == nil {
+		return threadfixSeverity, nil
+	}
+
+	switch UnmappedPolicy(UnmappedSeverity) {
+	case UnmappedSeverityPolicySkip:
+		logging.Logger.Warnf("Skipping vulnerability %s: %s", vulnerability.ID, err)
+		return "", errSkipFinding
+	case UnmappedSeverityPolicyDefault:
+		if UnmappedSeverity.Default != "" {
+			return UnmappedSeverity.Default, nil
+		}
+	}
+	return "", errors.New(fmt.Sprintf("unable to convert vulnerability %s: %s", vulnerability.ID, err))
+}
+
+// Policy for findings whose severity is not mapped; without an explicit policy, findings are given the default
+// severity when one is configured and skipped otherwise
+func UnmappedPolicy(unmapped UnmappedSeverityConf) string {
+	if unmapped.Policy != "" {
+		return strings.ToLower(unmapped.Policy)
+	}
+	if unmapped.Default != "" {
+		return UnmappedSeverityPolicyDefault
+	}
+	return UnmappedSeverityPolicySkip
+}
+
+// Whether a finding is left out of the scan, counting findings skipped for their unmapped severity
+func (converter *vulnerabilityConverter) omitted(err error) bool {
+	if err == errSkipFinding {
+		converter.skippedFindings = converter.skippedFindings + 1
+		return true
+	}
+	return err == errFilteredFinding
+}
+
+// Number of findings filtered by the export configuration's filters
+func (converter *vulnerabilityConverter) numFilteredFindings() int {
+	var numFiltered = 0
+	for _, count := range converter.filteredFindings {
+		numFiltered = numFiltered + count
+	}
+	return numFiltered
+}
+
+// Set finding metadata, omitting empty values
+func setMetadata(finding *threadfix.Finding, key string, value string) {
+	if value == "" {
+		return
+	}
+	if finding.Metadata == nil {
+		finding.Metadata = make(map[string]string)
+	}
+	finding.Metadata[key] = value
+}
+
+// Fetch Module details from cache or via API
+func (converter *vulnerabilityConverter) module(moduleId string) insightappsec.Module {
+	if module, ok := converter.modulesCache[moduleId]; ok {
+		converter.modulesCacheRequests = converter.modulesCacheRequests + 1
+		return module
+	}
+	module, _ := IasClient.GetModule(moduleId)
+	converter.modulesCache[moduleId] = module
+	converter.modulesApiRequests = converter.modulesApiRequests + 1
+	return module
+}
+
+func (converter *vulnerabilityConverter) logMetrics() {
+	metrics.Metrics.
+		WithField("module_cache", converter.modulesCacheRequests).
+		WithField("module_api", converter.modulesApiRequests).
+		WithField("attack_documentation_cache", converter.attackCacheRequests).
+		WithField("attack_documentation_api", converter.attackApiRequests).
+		WithField("skipped_findings", converter.skippedFindings).
+		Infof("ScanDetailsMetrics Ingestion")
 }
 
 // Map InsightAppSec Severity to Threadfix Severity based on configuration file
 func MapSeverity(insightappsecSeverity string) (string, error) {
+	return MapFindingSeverity(insightappsecSeverity, "", "")
+}
+
+// Map the InsightAppSec severity of a finding to a Threadfix severity, preferring the mapping whose conditions match
+// the finding's module ID and primary CWE most specifically; a module condition is more specific than a CWE condition
+func MapFindingSeverity(insightappsecSeverity string, moduleId string, cwe string) (string, error) {
 	var threadfixSeverity string
+	var specificity = -1
 
 	for _, severityMapping := range SeverityMappings {
-		if strings.EqualFold(severityMapping.InsightAppSec, insightappsecSeverity) {
+		if !strings.EqualFold(severityMapping.InsightAppSec, insightappsecSeverity) {
+			continue
+		}
+		var mappingSpecificity = 0
+		if severityMapping.Module != "" {
+			if !strings.EqualFold(severityMapping.Module, moduleId) {
+				continue
+			}
+			mappingSpecificity = mappingSpecificity + 2
+		}
+		if severityMapping.CWE != "" {
+			if mappingCwe, ok := ParseCWE(severityMapping.CWE); !ok || mappingCwe != cwe {
+				continue
+			}
+			mappingSpecificity = mappingSpecificity + 1
+		}
+		if mappingSpecificity > specificity {
 			threadfixSeverity = severityMapping.Threadfix
-			break
+			specificity = mappingSpecificity
 		}
 	}
 
@@ -512,10 +1065,11 @@ func FilterByScanConfig(scans []insightappsec.Scan, regex string) ([]insightapps
 	var filteredScans []insightappsec.Scan
 
 	for _, scan := range scans {
-		var scanConfig, err = IasClient.GetScanConfigByID(scan.ScanConfig.ID)
+		var scanConfig, err = cachedScanConfig(scan.ScanConfig.ID)
 		if err != nil {
+			// Matching the filter against an unknown scan config name would silently import or skip the scan
 			logging.Logger.Error("Error in insightappsec_threadfix/FilterByScanConfig", err)
-			continue
+			return nil, err
 		}
 
 		match, _ := regexp.MatchString(regex, scanConfig.Name)
@@ -528,12 +1082,66 @@ func FilterByScanConfig(scans []insightappsec.Scan, regex string) ([]insightapps
 	return filteredScans, nil
 }
 
+// Keep the scans whose status is one of the statuses, COMPLETE when none are given. Scans that failed or were
+// cancelled are reported with their failure reason; scans still running are imported by a later run once complete.
+func FilterByStatus(scans []insightappsec.Scan, statuses []string) []insightappsec.Scan {
+	var filteredScans []insightappsec.Scan
+
+	for _, scan := range scans {
+		if scanSelected(scan, statuses) {
+			filteredScans = append(filteredScans, scan)
+		} else if scanEnded(scan) {
+			logging.Logger.Warnf("Skipping scan %s of app %s with status %s%s", scan.ID, scan.App.ID, scan.Status,
+				failureReason(scan))
+		} else {
+			logging.Logger.Infof("Skipping scan %s of app %s with status %s", scan.ID, scan.App.ID, scan.Status)
+		}
+	}
+	logging.Logger.Debugf("Status filtering: %d scans filtered out of %d original scans with statuses: %v",
+		len(filteredScans), len(scans), statuses)
+	return filteredScans
+}
+
+// Whether a scan has one of the statuses, or is complete when none are given
+func scanSelected(scan insightappsec.Scan, statuses []string) bool {
+	if len(statuses) == 0 {
+		statuses = []string{insightappsec.ScanStatusComplete}
+	}
+	for _, status := range statuses {
+		if strings.EqualFold(status, scan.Status) {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether a scan ended without completing, e.g. it failed or was cancelled
+func scanEnded(scan insightappsec.Scan) bool {
+	for _, status := range insightappsec.EndedScanStatuses {
+		if strings.EqualFold(status, scan.Status) {
+			return true
+		}
+	}
+	return false
+}
+
+// Failure reason of a scan for messages, e.g. ": Authentication failed"
+func failureReason(scan insightappsec.Scan) string {
+	if scan.FailureReason == "" {
+		return ""
+	}
+	return ": " + scan.FailureReason
+}
+
 func FilterByDate(scans []insightappsec.Scan, date time.Time) []insightappsec.Scan {
 	var filteredScans []insightappsec.Scan
 
 	for _, scan := range scans {
-		trimTime := strings.Split(scan.CompletionTime, ".") // Trim millisecond from time to normalize between products
-		scanCompleted, _ := time.Parse(time.RFC3339, trimTime[0]+"Z")
+		scanCompleted, err := ParseCompletionTime(scan)
+		if err != nil {
+			logging.Logger.Errorf("Unable to parse completion time of scan %s: %s", scan.ID, err)
+			continue
+		}
 
 		if scanCompleted.After(date) {
 			filteredScans = append(filteredScans, scan)
@@ -544,32 +1152,15 @@ func FilterByDate(scans []insightappsec.Scan, date time.Time) []insightappsec.Sc
 	return filteredScans
 }
 
-func MapAttackDocumentation(attackDoc insightappsec.AttackDocumentation) []threadfix.Mapping {
-	mappings := []threadfix.Mapping{}
-	var cweMatch = false
-
-	for key, _ := range attackDoc.References {
-		var mapping threadfix.Mapping
-		var mappingType = strings.Split(key, "-")
-
-		if mappingType[0] == shared.CWE {
-			mapping.MappingType = mappingType[0]
-			mapping.Value = mappingType[1]
-			// Only label a single CWE instance as primary
-			if cweMatch == false {
-				mapping.Primary = true
-				cweMatch = true
-			}
-		} else {
-			mapping.MappingType = threadfix.ToolVendor
-			mapping.Value = key
-			mapping.Primary = false
-			mapping.VendorOtherType = mappingType[0]
-		}
+// Parse the UTC completion time of an InsightAppSec scan
+func ParseCompletionTime(scan insightappsec.Scan) (time.Time, error) {
+	return parseScanTime(scan.CompletionTime)
+}
 
-		mappings = append(mappings, mapping)
-	}
-	return mappings
+// Parse a UTC time of an InsightAppSec scan
+func parseScanTime(scanTime string) (time.Time, error) {
+	trimTime := strings.Split(scanTime, ".") // Trim millisecond from time to normalize between products
+	return time.Parse(time.RFC3339, trimTime[0]+"Z")
 }
 
 func FormatDate(dateTime string) string {
@@ -584,12 +1175,30 @@ func PersistScan(scan insightappsec.Scan, threadfixScan threadfix.ThreadfixScan)
 	if scanJson, err := json.Marshal(threadfixScan); err != nil {
 		logging.Logger.Errorf("Error marshaling JSON for scan to persist to filesystem. Scan ID %s", scan.ID)
 	} else {
-		filename := fmt.Sprintf("InsightAppSec-ScanID-%s.json", scan.ID)
+		filename := persistedScanFileName(scan)
 		_ = ioutil.WriteFile(filename, scanJson, 0600)
 		logging.Logger.Infof("Persisted scan ID %s to filesystem: %s", scan.ID, filename)
 	}
 }
 
+// Name a scan is uploaded with; Threadfix keeps it as the imported scan's original file name, identifying the
+// InsightAppSec scan
+func scanFileName(scanId string) string {
+	return fmt.Sprintf("InsightAppSec-ScanID-%s.threadfix", scanId)
+}
+
+func persistedScanFileName(scan insightappsec.Scan) string {
+	return fmt.Sprintf("InsightAppSec-ScanID-%s.json", scan.ID)
+}
+
+func scanIds(scans []insightappsec.Scan) []string {
+	var ids []string
+	for _, scan := range scans {
+		ids = append(ids, scan.ID)
+	}
+	return ids
+}
+
 // Reverse order of scans to older to newest to ensure they are processed in the proper order
 func reverse(scans []insightappsec.Scan) []insightappsec.Scan {
 	for i := 0; i < len(scans)/2; i++ {
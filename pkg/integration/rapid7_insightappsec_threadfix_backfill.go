@@ -0,0 +1,241 @@
+package integration
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/insightappsec"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/threadfix"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/shared/logging"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/shared/metrics"
+)
+
+// Import every InsightAppSec scan completed within a date range for the given export configurations, oldest to
+// newest, skipping scans already present in Threadfix. An optional regex limits the InsightAppSec applications.
+// Applications that fail to backfill do not stop the others; they are reported together in the returned error.
+// Progress is checkpointed per Threadfix application, so a backfill interrupted by shutdown returns an error with the
+// number of scans remaining and resumes from the checkpoint when run again.
+func Backfill(exportConfigurations []ExportConfiguration, appFilter string, from time.Time, to time.Time) (int, error) {
+	var numSubmittedScans = 0
+	var numRemainingScans = 0
+	var numSkippedConfigurations = 0
+	var failures []string
+
+	appRegex, err := regexp.Compile(appFilter)
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("invalid application filter %s: %s", appFilter, err))
+	}
+
+	ResetFilteredFindings()
+	ResetRunCache()
+	defer logFilteredFindings()
+	for index, exportConfiguration := range exportConfigurations {
+		if ShutdownRequested() {
+			logging.Logger.Info("Skipping remaining export configurations due to shutdown")
+			numSkippedConfigurations = len(exportConfigurations) - index
+			break
+		}
+
+		logging.Logger.Infof("Begin backfill of [%s] export configuration from %s to %s",
+			exportConfiguration.Name, from.Format(time.RFC3339), to.Format(time.RFC3339))
+		processStart := time.Now()
+
+		var insightappsecApps []insightappsec.Application
+		for _, app := range scopedApps(exportConfiguration.ApplicationScope, exportConfiguration) {
+			if appRegex.MatchString(app.Name) {
+				insightappsecApps = append(insightappsecApps, app)
+			}
+		}
+
+		var numScans int
+		if exportConfiguration.MapApplicationByName {
+			for _, insightappsecApp := range insightappsecApps {
+				threadfixApp, err := ThreadfixClient.GetAppByName(exportConfiguration.ThreadfixTeamName,
+					insightappsecApp.Name)
+				if err != nil || threadfixApp.AppData.Name == "" {
+					logging.Logger.Errorf("Failed to return Threadfix Application with name %s: %v",
+						insightappsecApp.Name, err)
+					failures = append(failures, fmt.Sprintf("[%s] %s: Threadfix Application not found",
+						exportConfiguration.Name, insightappsecApp.Name))
+					continue
+				}
+
+				count, remaining, err := backfillApp(threadfixApp, []insightappsec.Application{insightappsecApp},
+					exportConfiguration.ScanConfigFilter, from, to, exportConfiguration)
+				numScans += count
+				numRemainingScans += remaining
+				if err != nil {
+					logging.Logger.Errorf("Failed to backfill scans to %s Threadfix Application: %s",
+						threadfixApp.AppData.Name, err)
+					failures = append(failures, fmt.Sprintf("[%s] %s: %s", exportConfiguration.Name,
+						threadfixApp.AppData.Name, err))
+				}
+			}
+		} else {
+			threadfixApp, err := ThreadfixClient.GetAppByName(exportConfiguration.ThreadfixTeamName,
+				exportConfiguration.ThreadfixApplicationName)
+			if err != nil || threadfixApp.AppData.Name == "" {
+				logging.Logger.Errorf("Failed to return Threadfix Application with name %s: %v",
+					exportConfiguration.ThreadfixApplicationName, err)
+				failures = append(failures, fmt.Sprintf("[%s] %s: Threadfix Application not found",
+					exportConfiguration.Name, exportConfiguration.ThreadfixApplicationName))
+				continue
+			}
+
+			var remaining int
+			numScans, remaining, err = backfillApp(threadfixApp, insightappsecApps,
+				exportConfiguration.ScanConfigFilter, from, to, exportConfiguration)
+			numRemainingScans += remaining
+			if err != nil {
+				logging.Logger.Errorf("Failed to backfill scans to %s Threadfix Application: %s",
+					threadfixApp.AppData.Name, err)
+				failures = append(failures, fmt.Sprintf("[%s] %s: %s", exportConfiguration.Name,
+					threadfixApp.AppData.Name, err))
+			}
+		}
+		numSubmittedScans += numScans
+
+		metrics.Metrics.
+			WithField("start_time", processStart).
+			WithField("end_time", time.Now()).
+			WithField("export_configuration", exportConfiguration.Name).
+			WithField("duration", time.Since(processStart).Seconds()).
+			WithField("number_of_apps", len(insightappsecApps)).
+			WithField("number_of_scans", numScans).
+			Infof("Backfill Ingestion")
+		logging.Logger.Infof("End backfill of [%s] export configuration", exportConfiguration.Name)
+	}
+
+	var failureMessage string
+	if len(failures) > 0 {
+		failureMessage = fmt.Sprintf("failed to backfill %d application(s): %s", len(failures),
+			strings.Join(failures, "; "))
+	}
+	if ShutdownRequested() {
+		message := fmt.Sprintf("backfill interrupted by shutdown with %d scan(s) remaining and %d export "+
+			"configuration(s) not started; run the backfill again to resume", numRemainingScans,
+			numSkippedConfigurations)
+		if failureMessage != "" {
+			message = message + "; " + failureMessage
+		}
+		return numSubmittedScans, errors.New(message)
+	}
+	if failureMessage != "" {
+		return numSubmittedScans, errors.New(failureMessage)
+	}
+	return numSubmittedScans, nil
+}
+
+// Backfill the scans missing from a Threadfix application, returning the number of scans submitted and the number
+// left in the application's backfill checkpoint
+func backfillApp(threadfixApp threadfix.Application, applications []insightappsec.Application, scanConfigFilter string,
+	from time.Time, to time.Time, exportConfiguration ExportConfiguration) (int, int, error) {
+	var scans []insightappsec.Scan
+	var numResumedScans int
+
+	checkpoint, err := LoadBackfillCheckpoint(exportConfiguration.Name, threadfixApp.AppData.ID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Finish the scans an interrupted backfill left before looking for further missing scans
+	if checkpoint.Pending() {
+		logging.Logger.Infof("Resuming interrupted backfill of %d scan(s) to %s Threadfix Application",
+			len(checkpoint.RemainingScans), threadfixApp.AppData.Name)
+		numResumedScans, err = ResumeScans(threadfixApp, checkpoint, exportConfiguration)
+		if err != nil || checkpoint.Pending() {
+			return numResumedScans, len(checkpoint.RemainingScans), err
+		}
+	}
+
+	for _, app := range applications {
+		scans = append(scans, scopedScans(app.ID, exportConfiguration)...)
+	}
+
+	scans = FilterByStatus(scans, exportConfiguration.ScanStatuses)
+	scans, err = FilterByScanConfig(scans, scanConfigFilter)
+	if err != nil {
+		return numResumedScans, 0, err
+	}
+	scans = FilterByDateRange(scans, from, to)
+
+	existingScans, err := ThreadfixClient.ListScans(threadfixApp.AppData.ID)
+	if err != nil {
+		return numResumedScans, 0, err
+	}
+	missingScans := scansMissingFromThreadfix(scans, existingScans)
+	logging.Logger.Infof("%d of %d scan(s) in range are missing from %s Threadfix Application",
+		len(missingScans), len(scans), threadfixApp.AppData.Name)
+
+	SortByCompletionTime(missingScans)
+	if err := checkpoint.Start(scanIds(missingScans)); err != nil {
+		logging.Logger.Errorf("Failed to save checkpoint in insightappsec_threadfix/backfillApp: %s", err)
+	}
+	numSubmittedScans, err := uploadScans(threadfixApp, missingScans, checkpoint, exportConfiguration)
+	return numResumedScans + numSubmittedScans, len(checkpoint.RemainingScans), err
+}
+
+// Return the scans not yet imported to Threadfix. Threadfix keeps the name each scan was uploaded with, which carries
+// the InsightAppSec scan ID. Threadfix versions that do not list file names fall back to the scan's updated date,
+// which Threadfix records as the scan completion time to the second; only scans imported from InsightAppSec are
+// considered, so another scanner's scan completing in the same second does not hide an InsightAppSec scan.
+func scansMissingFromThreadfix(scans []insightappsec.Scan,
+	existingScans []threadfix.ScanMetadata) []insightappsec.Scan {
+	importedFiles := make(map[string]bool)
+	importedTimes := make(map[int64]bool)
+	for _, existingScan := range existingScans {
+		if existingScan.ScannerName != threadfix.ScannerSource {
+			continue
+		}
+		if len(existingScan.OriginalFileNames) == 0 {
+			importedTimes[int64(existingScan.UpdatedDate/1000)] = true
+		}
+		for _, fileName := range existingScan.OriginalFileNames {
+			importedFiles[strings.TrimSuffix(fileName, ".zip")] = true
+		}
+	}
+
+	var missingScans []insightappsec.Scan
+	for _, scan := range scans {
+		completed, _ := ParseCompletionTime(scan)
+		if importedFiles[scanFileName(scan.ID)] || importedTimes[completed.Unix()] {
+			logging.Logger.Debugf("Scan %s completed %s already present in Threadfix; skipping",
+				scan.ID, completed.String())
+			continue
+		}
+		missingScans = append(missingScans, scan)
+	}
+	return missingScans
+}
+
+func FilterByDateRange(scans []insightappsec.Scan, from time.Time, to time.Time) []insightappsec.Scan {
+	var filteredScans []insightappsec.Scan
+
+	for _, scan := range scans {
+		scanCompleted, err := ParseCompletionTime(scan)
+		if err != nil {
+			logging.Logger.Errorf("Unable to parse completion time of scan %s: %s", scan.ID, err)
+			continue
+		}
+
+		if !scanCompleted.Before(from) && !scanCompleted.After(to) {
+			filteredScans = append(filteredScans, scan)
+		}
+	}
+	logging.Logger.Debugf("Date range filtering: %d scans filtered out of %d original scans between %s and %s",
+		len(filteredScans), len(scans), from.String(), to.String())
+	return filteredScans
+}
+
+// Sort scans from oldest to newest by completion time
+func SortByCompletionTime(scans []insightappsec.Scan) {
+	sort.SliceStable(scans, func(i, j int) bool {
+		first, _ := ParseCompletionTime(scans[i])
+		second, _ := ParseCompletionTime(scans[j])
+		return first.Before(second)
+	})
+}
@@ -0,0 +1,171 @@
+package integration
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/shared/logging"
+)
+
+const ScanImportFormatCSV = "csv"
+const ScanImportFormatJSON = "json"
+
+// An InsightAppSec scan to import with optional Threadfix team and application overrides
+type ScanImportRequest struct {
+	ScanID string `json:"scan_id"`
+	Team   string `json:"team,omitempty"`
+	App    string `json:"app,omitempty"`
+}
+
+type ScanImportResult struct {
+	Request ScanImportRequest
+	Error   error
+}
+
+// Parse scan import requests as CSV (scan_id[,team,app] per line) or JSON (an array or stream of objects); the
+// format is detected from the content when not provided
+func ParseScanImportRequests(reader io.Reader, format string) ([]ScanImportRequest, error) {
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to read scan IDs: %s", err))
+	}
+
+	if format == "" {
+		trimmed := bytes.TrimSpace(content)
+		if len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+			format = ScanImportFormatJSON
+		} else {
+			format = ScanImportFormatCSV
+		}
+	}
+
+	switch strings.ToLower(format) {
+	case ScanImportFormatCSV:
+		return parseScanImportCSV(content)
+	case ScanImportFormatJSON:
+		return parseScanImportJSON(content)
+	}
+	return nil, errors.New(fmt.Sprintf("unsupported scan import format %s; expected csv or json", format))
+}
+
+func parseScanImportCSV(content []byte) ([]ScanImportRequest, error) {
+	var requests []ScanImportRequest
+	var lines []string
+
+	// Drop blank lines and comments before parsing
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+
+	csvReader := csv.NewReader(strings.NewReader(strings.Join(lines, "\n")))
+	csvReader.FieldsPerRecord = -1
+	csvReader.TrimLeadingSpace = true
+	records, err := csvReader.ReadAll()
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to parse scan IDs as CSV: %s", err))
+	}
+
+	for index, record := range records {
+		// Optional header row
+		if index == 0 && strings.EqualFold(record[0], "scan_id") {
+			continue
+		}
+		if len(record) > 3 {
+			return nil, errors.New(fmt.Sprintf("unable to parse scan IDs as CSV: line %d has more than 3 fields "+
+				"(scan_id,team,app)", index+1))
+		}
+
+		var request = ScanImportRequest{ScanID: strings.TrimSpace(record[0])}
+		if len(record) > 1 {
+			request.Team = strings.TrimSpace(record[1])
+		}
+		if len(record) > 2 {
+			request.App = strings.TrimSpace(record[2])
+		}
+		requests = append(requests, request)
+	}
+	return requests, nil
+}
+
+func parseScanImportJSON(content []byte) ([]ScanImportRequest, error) {
+	var requests []ScanImportRequest
+
+	if trimmed := bytes.TrimSpace(content); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &requests); err != nil {
+			return nil, errors.New(fmt.Sprintf("unable to parse scan IDs as JSON: %s", err))
+		}
+		return requests, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	for {
+		var request ScanImportRequest
+		if err := decoder.Decode(&request); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.New(fmt.Sprintf("unable to parse scan IDs as JSON: %s", err))
+		}
+		requests = append(requests, request)
+	}
+	return requests, nil
+}
+
+// Export configuration of scans imported by ID: the export configuration with the name when provided, otherwise the
+// default settings, which apply the default redaction
+func ScanImportConfiguration(exportConfigurations []ExportConfiguration, name string) (ExportConfiguration, error) {
+	if name == "" {
+		return ExportConfiguration{}, nil
+	}
+	for _, exportConfiguration := range exportConfigurations {
+		if exportConfiguration.Name == name {
+			return exportConfiguration, nil
+		}
+	}
+	return ExportConfiguration{}, errors.New(fmt.Sprintf("no export configuration found with name %s", name))
+}
+
+// Import each requested scan, falling back to the default Threadfix team and application when a request does not
+// override them. A failure is recorded in the scan's result and never stops the remaining imports.
+func BulkImportScans(requests []ScanImportRequest, defaultTeam string, defaultApp string,
+	exportConfiguration ExportConfiguration) []ScanImportResult {
+	var results []ScanImportResult
+
+	for index, request := range requests {
+		if request.Team == "" {
+			request.Team = defaultTeam
+		}
+		if request.App == "" {
+			request.App = defaultApp
+		}
+		var result = ScanImportResult{Request: request}
+
+		if ShutdownRequested() {
+			result.Error = errors.New("not imported due to shutdown")
+		} else if request.ScanID == "" {
+			result.Error = errors.New(fmt.Sprintf("entry %d has no scan ID", index+1))
+		} else if request.Team == "" || request.App == "" {
+			result.Error = errors.New("no Threadfix team and application provided for scan")
+		} else {
+			logging.Logger.Infof("Importing scan %d of %d: %s to Threadfix Application %s (Team: %s)",
+				index+1, len(requests), request.ScanID, request.App, request.Team)
+			_, result.Error = ImportScan(request.ScanID, request.App, request.Team, exportConfiguration)
+		}
+
+		if result.Error != nil {
+			logging.Logger.Errorf("Failed to import scan %s: %s", request.ScanID, result.Error)
+		}
+		results = append(results, result)
+	}
+	return results
+}
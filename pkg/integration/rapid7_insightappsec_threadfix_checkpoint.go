@@ -0,0 +1,148 @@
+package integration
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/shared/logging"
+)
+
+var CheckpointDirectory string
+
+// Progress of an import for a single export configuration and Threadfix application; persisted after every upload
+// so an interrupted run resumes with the scans that were not yet imported
+type Checkpoint struct {
+	ExportConfiguration string   `json:"export_configuration"`
+	ThreadfixAppID      int      `json:"threadfix_app_id"`
+	Backfill            bool     `json:"backfill,omitempty"`
+	RemainingScans      []string `json:"remaining_scans"`
+	LastUploadedScan    string   `json:"last_uploaded_scan,omitempty"`
+	Attempts            int      `json:"attempts"`
+	Updated             string   `json:"updated"`
+}
+
+var unsafeFilenameCharacters = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+func checkpointPath(exportConfigurationName string, threadfixAppId int, backfill bool) string {
+	directory := CheckpointDirectory
+	if directory == "" {
+		directory = DefaultCheckpointDirectory
+	}
+	prefix := "checkpoint"
+	if backfill {
+		prefix = "backfill-checkpoint"
+	}
+	filename := fmt.Sprintf("%s-%s-%d.json", prefix,
+		unsafeFilenameCharacters.ReplaceAllString(exportConfigurationName, "_"), threadfixAppId)
+	return filepath.Join(directory, filename)
+}
+
+// Load the checkpoint for an export configuration and Threadfix application; an empty checkpoint is returned if no
+// import is in progress
+func LoadCheckpoint(exportConfigurationName string, threadfixAppId int) (*Checkpoint, error) {
+	return loadCheckpoint(exportConfigurationName, threadfixAppId, false)
+}
+
+// Load the checkpoint of a backfill for an export configuration and Threadfix application; kept apart from the
+// checkpoint of scheduled imports so neither run resumes the other's scans
+func LoadBackfillCheckpoint(exportConfigurationName string, threadfixAppId int) (*Checkpoint, error) {
+	return loadCheckpoint(exportConfigurationName, threadfixAppId, true)
+}
+
+func loadCheckpoint(exportConfigurationName string, threadfixAppId int, backfill bool) (*Checkpoint, error) {
+	checkpoint := &Checkpoint{ExportConfiguration: exportConfigurationName, ThreadfixAppID: threadfixAppId,
+		Backfill: backfill}
+
+	fileBytes, err := ioutil.ReadFile(checkpointPath(exportConfigurationName, threadfixAppId, backfill))
+	if os.IsNotExist(err) {
+		return checkpoint, nil
+	} else if err != nil {
+		return checkpoint, fmt.Errorf("unable to read checkpoint: %s", err)
+	}
+
+	if err := json.Unmarshal(fileBytes, checkpoint); err != nil {
+		return checkpoint, fmt.Errorf("unable to parse checkpoint: %s", err)
+	}
+	return checkpoint, nil
+}
+
+// Whether a previous run left scans that were not imported
+func (checkpoint *Checkpoint) Pending() bool {
+	return checkpoint != nil && len(checkpoint.RemainingScans) > 0
+}
+
+// Record the scans, ordered oldest to newest, that are about to be imported
+func (checkpoint *Checkpoint) Start(scanIds []string) error {
+	if checkpoint == nil {
+		return nil
+	}
+	checkpoint.RemainingScans = scanIds
+	checkpoint.Attempts = 0
+	return checkpoint.save()
+}
+
+// Record a failed upload of the next remaining scan, returning the number of attempts made so far
+func (checkpoint *Checkpoint) Failed() (int, error) {
+	if checkpoint == nil {
+		return 0, nil
+	}
+	checkpoint.Attempts++
+	return checkpoint.Attempts, checkpoint.save()
+}
+
+// Remove a scan from the remaining scans once it has been uploaded or abandoned
+func (checkpoint *Checkpoint) Complete(scanId string, uploaded bool) error {
+	if checkpoint == nil {
+		return nil
+	}
+	var remaining []string
+	for _, id := range checkpoint.RemainingScans {
+		if id != scanId {
+			remaining = append(remaining, id)
+		}
+	}
+	checkpoint.RemainingScans = remaining
+	checkpoint.Attempts = 0
+	if uploaded {
+		checkpoint.LastUploadedScan = scanId
+	}
+	return checkpoint.save()
+}
+
+func (checkpoint *Checkpoint) save() error {
+	path := checkpointPath(checkpoint.ExportConfiguration, checkpoint.ThreadfixAppID, checkpoint.Backfill)
+
+	// Nothing left to import; remove the checkpoint so the next run starts from Threadfix's latest scan
+	if len(checkpoint.RemainingScans) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to remove checkpoint %s: %s", path, err)
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return fmt.Errorf("unable to create checkpoint directory: %s", err)
+	}
+
+	checkpoint.Updated = time.Now().UTC().Format(time.RFC3339)
+	checkpointJson, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal checkpoint: %s", err)
+	}
+
+	// Write to a temporary file and rename so a crash never leaves a partially written checkpoint
+	tempPath := path + ".tmp"
+	if err := ioutil.WriteFile(tempPath, checkpointJson, 0600); err != nil {
+		return fmt.Errorf("unable to write checkpoint %s: %s", tempPath, err)
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		return fmt.Errorf("unable to write checkpoint %s: %s", path, err)
+	}
+	logging.Logger.Debugf("Checkpoint saved to %s with %d scan(s) remaining", path, len(checkpoint.RemainingScans))
+	return nil
+}
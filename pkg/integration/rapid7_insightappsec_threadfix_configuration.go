@@ -1,16 +1,12 @@
 package integration
 
 import (
-	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/go-resty/resty/v2"
 	"github.com/manifoldco/promptui"
 	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/threadfix"
 	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/shared"
 	log "github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
 	"strconv"
 	"strings"
 )
@@ -21,13 +17,14 @@ var messages Messages
 const YES = "Yes"
 const NO = "No"
 const DONE = "Done"
+const SHOW_CHANGES = "Show Changes"
 
 type Messages struct {
-	NotConfigured string
-	Configured string
-	ConnectionsConfig string
+	NotConfigured        string
+	Configured           string
+	ConnectionsConfig    string
 	ConfigurationsConfig string
-	SeverityConfig string
+	SeverityConfig       string
 }
 
 func init() {
@@ -42,7 +39,7 @@ func init() {
 
 // check if configuration has been completed
 func ConfigComplete() (bool, string) {
-	emptyInsightAppSecConn :=  InsightAppSecConnection{}
+	emptyInsightAppSecConn := InsightAppSecConnection{}
 	emptyThreadfixConn := ThreadfixConnection{}
 	if Configuration.Connections.InsightAppSec == emptyInsightAppSecConn ||
 		Configuration.Connections.Threadfix == emptyThreadfixConn ||
@@ -61,13 +58,14 @@ func Configure(message string) (bool, *SettingsConf) {
 		// Set up Connections
 		fmt.Println(messages.ConnectionsConfig)
 		// InsightAppSec Connection
-		region, _ := StringPrompt("What region is your InsightAppSec account? Example regions are: us, eu, ca, " +
-			"au, ap. A full list of supported region codes is documented here: " +
+		region, _ := StringPrompt("What region is your InsightAppSec account? Example regions are: us, eu, ca, "+
+			"au, ap. A full list of supported region codes is documented here: "+
 			"https://insight.help.rapid7.com/docs/product-apis#section-supported-regions", false,
 			Configuration.Connections.InsightAppSec.Region)
 		Configuration.Connections.InsightAppSec.Region = region
-		apiKey, _ := StringPrompt("What is your InsightAppSec API key?", true,
-			shared.Decrypt(Configuration.Connections.InsightAppSec.Apikey))
+		apiKey, _ := StringPrompt("What is your InsightAppSec API key? You may also reference a secret stored "+
+			"elsewhere with env:VARIABLE, file:PATH, or cmd:COMMAND", true,
+			secretDefault(Configuration.Connections.InsightAppSec.Apikey))
 		Configuration.Connections.InsightAppSec.Apikey = apiKey
 
 		//Threadfix Connection
@@ -77,8 +75,9 @@ func Configure(message string) (bool, *SettingsConf) {
 		port, _ := StringPrompt("What is your Threadfix port?", false,
 			Configuration.Connections.Threadfix.Port)
 		Configuration.Connections.Threadfix.Port = port
-		apiKey, _ = StringPrompt("What is your Threadfix API key?", true,
-			shared.Decrypt(Configuration.Connections.Threadfix.Apikey))
+		apiKey, _ = StringPrompt("What is your Threadfix API key? You may also reference a secret stored "+
+			"elsewhere with env:VARIABLE, file:PATH, or cmd:COMMAND", true,
+			secretDefault(Configuration.Connections.Threadfix.Apikey))
 		Configuration.Connections.Threadfix.Apikey = apiKey
 
 		// Set up Configurations
@@ -136,6 +135,10 @@ func Configure(message string) (bool, *SettingsConf) {
 			for {
 				var severityList []string
 				for _, severity := range Configuration.SeverityMappings {
+					// Conditional mappings are only configured in the configuration file
+					if severity.Module != "" || severity.CWE != "" {
+						continue
+					}
 					severityList = append(severityList,
 						fmt.Sprintf("%s : %s", severity.InsightAppSec, severity.Threadfix))
 				}
@@ -148,14 +151,18 @@ func Configure(message string) (bool, *SettingsConf) {
 				sev := strings.Split(severity, " : ")
 
 				var currentSeverityNames []string
-				for _, currentSeverity := range ThreadfixSeverities() {
+				var currentSeverities = ThreadfixSeverities()
+				for _, currentSeverity := range currentSeverities {
 					currentSeverityNames = append(currentSeverityNames, currentSeverity.Name)
 				}
 				threadfixSev, _ := PromptList(fmt.Sprintf("What Threadfix severity should be assigned to the [%s] "+
 					"InsightAppSec severity?", sev[0]), currentSeverityNames)
+				// Store the int value so the mapping survives the severity being renamed in Threadfix
+				resolved, _ := ResolveSeverity(currentSeverities, SeverityMapping{Threadfix: threadfixSev})
 				for index, s := range Configuration.SeverityMappings {
-					if s.InsightAppSec == sev[0] {
+					if s.InsightAppSec == sev[0] && s.Module == "" && s.CWE == "" {
 						Configuration.SeverityMappings[index].Threadfix = threadfixSev
+						Configuration.SeverityMappings[index].ThreadfixIntValue = resolved.IntValue
 						log.Info(fmt.Sprintf("Assigning InsightAppSec severity [%s] to Threadfix severity [%s]",
 							s.InsightAppSec, threadfixSev))
 						break
@@ -187,7 +194,7 @@ func PromptList(label string, list []string) (string, error) {
 
 func PromptContinue() (string, error) {
 	prompt := promptui.Select{
-		Label:    "Continue?",
+		Label: "Continue?",
 		Items: []string{YES, NO},
 	}
 	var result string
@@ -215,6 +222,10 @@ func StringPrompt(label string, sensitive bool, def string) (string, error) {
 		prompt.Mask = '*'
 
 		string, err := prompt.Run()
+		// References to secrets stored elsewhere are saved as is
+		if shared.IsSecretReference(string) {
+			return string, err
+		}
 		return shared.Encrypt(string), err
 	}
 
@@ -223,38 +234,41 @@ func StringPrompt(label string, sensitive bool, def string) (string, error) {
 
 func ConfirmSave(configuration *SettingsConf) bool {
 	prompt := promptui.Select{
-		Label:    "Save Configuration?",
-		Items: []string{YES, NO},
+		Label: "Save Configuration?",
+		Items: []string{YES, NO, SHOW_CHANGES},
 	}
-	var result string
-	var err error
-	_, result, err = prompt.Run()
-	if err != nil {
-		fmt.Println("Prompt failed %v\n", err)
-		return false
-	} else if result == NO {
-		return false
-	} else {
-		requestByte, _ := json.Marshal(Configuration)
-		requestReader := bytes.NewReader(requestByte)
-		if err := viper.MergeConfig(requestReader); err != nil {
-			log.Infof("Failed to update configuration: %s", err)
+	for {
+		_, result, err := prompt.Run()
+		if err != nil {
+			fmt.Printf("Prompt failed %v\n", err)
+			return false
+		} else if result == NO {
+			return false
+		} else if result == SHOW_CHANGES {
+			diff, err := ConfigurationDiff(configuration)
+			if err != nil {
+				fmt.Printf("Unable to compare configuration: %s\n", err)
+			} else if diff == "" {
+				fmt.Println("No changes")
+			} else {
+				fmt.Print(diff)
+			}
 		} else {
-			if err := viper.WriteConfig(); err != nil {
-				panic(fmt.Sprintf("Failed to write configuration changes: %s", err))
+			if err := SaveConfiguration(configuration); err != nil {
+				fmt.Printf("Failed to write configuration changes: %s\n", err)
+				return false
 			}
+			return true
 		}
-
-		return true
 	}
 }
 
 func DefineExportConfiguration(configuration ExportConfiguration) ExportConfiguration {
-	configuration.ApplicationScope, _ = StringPrompt("What InsightAppSec Applications are within scope? You " +
-		"may provide a regular expression to match Applications by name. This will determine which applications' " +
+	configuration.ApplicationScope, _ = StringPrompt("What InsightAppSec Applications are within scope? You "+
+		"may provide a regular expression to match Applications by name. This will determine which applications' "+
 		"scans will be imported into Threadfix",
 		false, configuration.ApplicationScope)
-	configuration.ScanConfigFilter, _ = StringPrompt("Please define a Scan Config filter to limit the scans " +
+	configuration.ScanConfigFilter, _ = StringPrompt("Please define a Scan Config filter to limit the scans "+
 		"within scope. You may provide a regular expression to match Scan Configs by name", false,
 		configuration.ScanConfigFilter)
 	resp, _ := PromptList("Only import the most recent InsightAppSec scan when run?", []string{YES, NO})
@@ -264,23 +278,23 @@ func DefineExportConfiguration(configuration ExportConfiguration) ExportConfigur
 		configuration.LastScanOnly = false
 
 		// How many days back for initial scan
-		resp, _ = StringPrompt("You have chosen to import historical scans as the integration is run. Past " +
-			"scans will be imported from oldest to newest and provide the ability to import historical scan data. " +
+		resp, _ = StringPrompt("You have chosen to import historical scans as the integration is run. Past "+
+			"scans will be imported from oldest to newest and provide the ability to import historical scan data. "+
 			"How many days back from the initial import should be included?", false,
 			strconv.Itoa(configuration.InitialImportMaxDays))
 		configuration.InitialImportMaxDays, _ = strconv.Atoi(resp)
 	}
 	configuration.Name, _ = StringPrompt("Please provide a name for this configuration", false,
 		configuration.Name)
-	applicationMapping, _ := PromptList("Would you like to define a single Threadfix application where these " +
-		"scans will be imported, or should scans be imported to a Threadfix application that is based on the " +
+	applicationMapping, _ := PromptList("Would you like to define a single Threadfix application where these "+
+		"scans will be imported, or should scans be imported to a Threadfix application that is based on the "+
 		"InsightAppSec application name?",
 		[]string{"Define single Threadfix application name", "Based on InsightAppSec application name"})
 	if applicationMapping == "Define single Threadfix application name" {
 		configuration.MapApplicationByName = false
 
 		// Ask for Threadfix Application Name
-		configuration.ThreadfixApplicationName, _ = StringPrompt("Please provide the name of the Threadfix " +
+		configuration.ThreadfixApplicationName, _ = StringPrompt("Please provide the name of the Threadfix "+
 			"application for the scans of this configuration", false, configuration.ThreadfixApplicationName)
 	} else {
 		configuration.MapApplicationByName = true
@@ -298,18 +312,42 @@ func DefineExportConfiguration(configuration ExportConfiguration) ExportConfigur
 	return configuration
 }
 
+// Default for a sensitive prompt; secret references are shown rather than resolved
+func secretDefault(value string) string {
+	if shared.IsSecretReference(value) {
+		return value
+	}
+	secret, err := shared.Decrypt(value)
+	if err != nil {
+		log.Errorf("Unable to decrypt current value: %s", err)
+	}
+	return secret
+}
+
 func ThreadfixSeverities() []threadfix.VulnerabilitySeverity {
+	apiKey, _ := shared.ResolveSecret(Configuration.Connections.Threadfix.Apikey)
 	var threadfixConfig = threadfix.ThreadfixConfiguration{
-		APIKey:   shared.Decrypt(Configuration.Connections.Threadfix.Apikey),
-		Host:     Configuration.Connections.Threadfix.Host,
-		Port:     Configuration.Connections.Threadfix.Port,
+		APIKey:  apiKey,
+		Host:    Configuration.Connections.Threadfix.Host,
+		Port:    Configuration.Connections.Threadfix.Port,
+		BaseURL: Configuration.Connections.Threadfix.BaseURL,
 	}
 
-	var apiConfig = shared.APIConfiguration{Timeout: 30, RestyClient: resty.New()}
+	restyClient, err := shared.NewRestyClient(TransportConfiguration(Configuration.Connections.Threadfix.Proxy,
+		Configuration.Connections.Threadfix.TLS))
+	if err != nil {
+		log.Errorf("Unable to configure Threadfix connection: %s", err)
+		return nil
+	}
+	var apiConfig = shared.APIConfiguration{Timeout: 30, RestyClient: restyClient}
 	var apiClient = shared.APIClient{Config: apiConfig}
 
 	var threadfix = threadfix.API{Config: threadfixConfig, APIClient: apiClient}
+	if err := threadfix.NegotiateVersion(Configuration.Connections.Threadfix.APIVersion); err != nil {
+		log.Errorf("Unable to connect to Threadfix: %s", err)
+		return nil
+	}
 
 	severities, _ := threadfix.ListSeverities()
 	return severities.SeveritiesMetadata
-}
\ No newline at end of file
+}
@@ -0,0 +1,102 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/shared"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+// Unmarshal the loaded configuration file. Settings are matched to fields by their canonical YAML key or, for
+// configuration files written by earlier versions, the field name, ignoring case and underscores.
+func UnmarshalConfiguration(settings *SettingsConf) error {
+	return viper.Unmarshal(settings, viper.DecodeHook(canonicalKeysHook))
+}
+
+func canonicalKeysHook(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+	if to.Kind() != reflect.Struct {
+		return data, nil
+	}
+
+	// Rename keys to field names, which the decoder matches case insensitively
+	switch document := data.(type) {
+	case map[string]interface{}:
+		renamed := make(map[string]interface{}, len(document))
+		for key, value := range document {
+			renamed[fieldNameForKey(to, key)] = value
+		}
+		return renamed, nil
+	case map[interface{}]interface{}:
+		renamed := make(map[interface{}]interface{}, len(document))
+		for key, value := range document {
+			renamed[fieldNameForKey(to, fmt.Sprintf("%v", key))] = value
+		}
+		return renamed, nil
+	}
+	return data, nil
+}
+
+func fieldNameForKey(structType reflect.Type, key string) string {
+	for i := 0; i < structType.NumField(); i++ {
+		structField := structType.Field(i)
+		yamlKey := strings.Split(structField.Tag.Get("yaml"), ",")[0]
+		if normalizeKey(key) == normalizeKey(structField.Name) || normalizeKey(key) == normalizeKey(yamlKey) {
+			return structField.Name
+		}
+	}
+	return key
+}
+
+// The configuration as written to the configuration file, using the canonical YAML keys
+func MarshalConfiguration(configuration *SettingsConf) ([]byte, error) {
+	return yaml.Marshal(configuration)
+}
+
+// Write the configuration to the loaded configuration file. YAML files are replaced atomically, keeping backups of
+// the previous contents.
+func SaveConfiguration(configuration *SettingsConf) error {
+	configFile := viper.ConfigFileUsed()
+	if !isYamlFile(configFile) {
+		requestByte, _ := json.Marshal(configuration)
+		requestReader := bytes.NewReader(requestByte)
+		if err := viper.MergeConfig(requestReader); err != nil {
+			log.Infof("Failed to update configuration: %s", err)
+			return err
+		}
+		return viper.WriteConfig()
+	}
+
+	content, err := MarshalConfiguration(configuration)
+	if err != nil {
+		return err
+	}
+	return shared.WriteFileAtomic(configFile, content, 0600, ConfigurationBackups)
+}
+
+// Line differences between the configuration file and the configuration as it would be saved
+func ConfigurationDiff(configuration *SettingsConf) (string, error) {
+	current, err := ioutil.ReadFile(viper.ConfigFileUsed())
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	proposed, err := MarshalConfiguration(configuration)
+	if err != nil {
+		return "", err
+	}
+	return shared.DiffLines(string(current), string(proposed)), nil
+}
+
+func isYamlFile(path string) bool {
+	extension := strings.ToLower(filepath.Ext(path))
+	return extension == ".yml" || extension == ".yaml"
+}
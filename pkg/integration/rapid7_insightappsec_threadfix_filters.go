@@ -0,0 +1,267 @@
+package integration
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/insightappsec"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/threadfix"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/shared/logging"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/shared/metrics"
+)
+
+// Reasons findings are filtered, as counted in the run summary
+const FilteredBySeverity = "severity"
+const FilteredByStatus = "status"
+const FilteredByPath = "path"
+const FilteredByModule = "module"
+const FilteredByCWE = "cwe"
+
+// Selects the findings of an export configuration according to its filters
+type findingFilter struct {
+	minSeverity    int
+	statuses       []string
+	includePaths   []*regexp.Regexp
+	excludePaths   []*regexp.Regexp
+	includeModules []string
+	excludeModules []string
+	includeCWEs    []string
+	excludeCWEs    []string
+}
+
+// Compile the filters of an export configuration; returns nil when every finding is exported
+func newFindingFilter(filters FilterConf) (*findingFilter, error) {
+	if filters.MinSeverity == "" && len(filters.Statuses) == 0 && len(filters.IncludePaths) == 0 &&
+		len(filters.ExcludePaths) == 0 && len(filters.IncludeModules) == 0 && len(filters.ExcludeModules) == 0 &&
+		len(filters.IncludeCWEs) == 0 && len(filters.ExcludeCWEs) == 0 {
+		return nil, nil
+	}
+
+	var filter = &findingFilter{minSeverity: severityIndex(filters.MinSeverity), statuses: filters.Statuses,
+		includeModules: filters.IncludeModules, excludeModules: filters.ExcludeModules}
+	if filters.MinSeverity != "" && filter.minSeverity < 0 {
+		return nil, errors.New(fmt.Sprintf("unknown InsightAppSec severity %q", filters.MinSeverity))
+	}
+
+	var err error
+	if filter.includePaths, err = compilePathPatterns(filters.IncludePaths); err != nil {
+		return nil, err
+	}
+	if filter.excludePaths, err = compilePathPatterns(filters.ExcludePaths); err != nil {
+		return nil, err
+	}
+	if filter.includeCWEs, err = parseCWEs(filters.IncludeCWEs); err != nil {
+		return nil, err
+	}
+	if filter.excludeCWEs, err = parseCWEs(filters.ExcludeCWEs); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// Reason the vulnerability's findings are filtered by its severity, status, or URL path; empty when exported
+func (filter *findingFilter) filterVulnerability(vulnerability insightappsec.Vulnerability) string {
+	if filter == nil {
+		return ""
+	}
+
+	// Vulnerabilities of an unknown severity are exported so they are not silently lost
+	if severity := severityIndex(vulnerability.Severity); filter.minSeverity > 0 && severity >= 0 &&
+		severity < filter.minSeverity {
+		return FilteredBySeverity
+	}
+	if len(filter.statuses) > 0 && !containsFold(filter.statuses, vulnerability.Status) {
+		return FilteredByStatus
+	}
+
+	var path = vulnerability.RootCause.URL
+	if parsed, err := url.Parse(vulnerability.RootCause.URL); err == nil {
+		path = parsed.Path
+	}
+	if len(filter.includePaths) > 0 && !matchesAny(filter.includePaths, path) {
+		return FilteredByPath
+	}
+	if matchesAny(filter.excludePaths, path) {
+		return FilteredByPath
+	}
+	return ""
+}
+
+// Reason a finding is filtered by its module or CWEs; empty when exported
+func (filter *findingFilter) filterFinding(module insightappsec.Module, mappings []threadfix.Mapping) string {
+	if filter == nil {
+		return ""
+	}
+
+	if len(filter.includeModules) > 0 && !matchesModule(filter.includeModules, module) {
+		return FilteredByModule
+	}
+	if matchesModule(filter.excludeModules, module) {
+		return FilteredByModule
+	}
+
+	var cwes []string
+	for _, mapping := range mappings {
+		if mapping.MappingType == threadfix.MappingTypeCWE {
+			cwes = append(cwes, mapping.Value)
+		}
+	}
+	if len(filter.includeCWEs) > 0 && !intersects(filter.includeCWEs, cwes) {
+		return FilteredByCWE
+	}
+	if intersects(filter.excludeCWEs, cwes) {
+		return FilteredByCWE
+	}
+	return ""
+}
+
+// Findings filtered from the scans uploaded during a run, by export configuration and filter reason
+var runFilteredFindings = struct {
+	sync.Mutex
+	byConfiguration map[string]map[string]int
+}{byConfiguration: make(map[string]map[string]int)}
+
+// Begin counting the findings filtered during a run
+func ResetFilteredFindings() {
+	runFilteredFindings.Lock()
+	defer runFilteredFindings.Unlock()
+	runFilteredFindings.byConfiguration = make(map[string]map[string]int)
+}
+
+// Add the findings filtered from an uploaded scan to the run's counts for its export configuration
+func recordFilteredFindings(exportConfigurationName string, filtered map[string]int) {
+	runFilteredFindings.Lock()
+	defer runFilteredFindings.Unlock()
+	counts, ok := runFilteredFindings.byConfiguration[exportConfigurationName]
+	if !ok {
+		counts = make(map[string]int)
+		runFilteredFindings.byConfiguration[exportConfigurationName] = counts
+	}
+	for reason, count := range filtered {
+		counts[reason] = counts[reason] + count
+	}
+}
+
+// Number of findings filtered for each reason during the run, by export configuration
+func FilteredFindings() map[string]map[string]int {
+	runFilteredFindings.Lock()
+	defer runFilteredFindings.Unlock()
+	var filtered = make(map[string]map[string]int)
+	for name, counts := range runFilteredFindings.byConfiguration {
+		filtered[name] = make(map[string]int)
+		for reason, count := range counts {
+			filtered[name][reason] = count
+		}
+	}
+	return filtered
+}
+
+// Report the findings filtered during the run for each export configuration and across all of them
+func logFilteredFindings() {
+	var total = make(map[string]int)
+	var numTotal = 0
+	for name, filtered := range FilteredFindings() {
+		var numFiltered = 0
+		for reason, count := range filtered {
+			total[reason] = total[reason] + count
+			numFiltered = numFiltered + count
+		}
+		numTotal = numTotal + numFiltered
+		if numFiltered > 0 {
+			logging.Logger.Infof("%d finding(s) filtered by the [%s] export configuration (%s)", numFiltered, name,
+				filteredSummary(filtered))
+		}
+		metrics.Metrics.
+			WithField("export_configuration", name).
+			WithField("number_of_filtered_findings", numFiltered).
+			WithField("filtered_findings", filtered).
+			Infof("Export Configuration Filtered Findings")
+	}
+	if numTotal > 0 {
+		logging.Logger.Infof("%d finding(s) filtered during this run (%s)", numTotal, filteredSummary(total))
+	}
+	metrics.Metrics.
+		WithField("number_of_filtered_findings", numTotal).
+		WithField("filtered_findings", total).
+		Infof("Run Summary")
+}
+
+// Summary of the number of findings filtered for each reason, e.g. "cwe: 2, severity: 5"
+func filteredSummary(filtered map[string]int) string {
+	var reasons []string
+	for reason, count := range filtered {
+		reasons = append(reasons, fmt.Sprintf("%s: %d", reason, count))
+	}
+	sort.Strings(reasons)
+	return strings.Join(reasons, ", ")
+}
+
+// Rank of an InsightAppSec severity, as ordered from lowest to highest by insightAppSecSeverities; -1 when unknown
+func severityIndex(severity string) int {
+	for index, insightAppSecSeverity := range insightAppSecSeverities {
+		if strings.EqualFold(insightAppSecSeverity, severity) {
+			return index
+		}
+	}
+	return -1
+}
+
+func compilePathPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid path pattern %q: %s", pattern, err))
+		}
+		compiled = append(compiled, regex)
+	}
+	return compiled, nil
+}
+
+func parseCWEs(values []string) ([]string, error) {
+	var cwes []string
+	for _, value := range values {
+		cwe, ok := ParseCWE(value)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("invalid CWE %q", value))
+		}
+		cwes = append(cwes, cwe)
+	}
+	return cwes, nil
+}
+
+func matchesAny(patterns []*regexp.Regexp, value string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether a module is listed by its ID or name
+func matchesModule(modules []string, module insightappsec.Module) bool {
+	for _, listed := range modules {
+		if (module.ID != "" && strings.EqualFold(listed, module.ID)) ||
+			(module.Name != "" && strings.EqualFold(listed, module.Name)) {
+			return true
+		}
+	}
+	return false
+}
+
+func intersects(values []string, others []string) bool {
+	for _, value := range values {
+		for _, other := range others {
+			if value == other {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package integration
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/shared"
+)
+
+// Generate a new encryption key and re-encrypt every encrypted sensitive setting with it. All settings are decrypted
+// before the key file changes, so a value that cannot be decrypted aborts the rotation with nothing modified. Returns
+// the new key's id and the settings that were re-encrypted; the caller saves the configuration.
+func RotateEncryptionKey(settings *SettingsConf) (string, []string, error) {
+	var plaintexts = make(map[string]string)
+	sensitive := sensitiveSettings(settings)
+
+	for path, field := range sensitive {
+		if !shared.IsEncrypted(field.String()) {
+			continue
+		}
+		plaintext, err := shared.ResolveSecret(field.String())
+		if err != nil {
+			return "", nil, errors.New(fmt.Sprintf("unable to decrypt %s with the current encryption keys; "+
+				"rotation aborted: %s", path, err))
+		}
+		plaintexts[path] = plaintext
+	}
+
+	keyId, err := shared.RotateKey()
+	if err != nil {
+		return "", nil, err
+	}
+
+	var reencrypted []string
+	for path, plaintext := range plaintexts {
+		sensitive[path].SetString(shared.Encrypt(plaintext))
+		reencrypted = append(reencrypted, path)
+	}
+	sort.Strings(reencrypted)
+	return keyId, reencrypted, nil
+}
+
+// Check every encrypted sensitive setting decrypts with the available keys, returning the settings that do not with
+// the reason they failed
+func CheckEncryptedSettings(settings *SettingsConf) []ValidationError {
+	var errors []ValidationError
+	for path, field := range sensitiveSettings(settings) {
+		if _, err := shared.Decrypt(field.String()); err != nil {
+			errors = append(errors, ValidationError{Setting: path, Message: err.Error()})
+		}
+	}
+	sort.Slice(errors, func(i, j int) bool {
+		return errors[i].Setting < errors[j].Setting
+	})
+	return errors
+}
+
+// Ids of the encryption keys the configuration's encrypted settings were encrypted with
+func EncryptionKeysInUse(settings *SettingsConf) []string {
+	var keyIds []string
+	for _, field := range sensitiveSettings(settings) {
+		if shared.IsEncrypted(field.String()) {
+			keyIds = append(keyIds, shared.EncryptionKeyID(field.String()))
+		}
+	}
+	return keyIds
+}
+
+// Settings tagged as sensitive, keyed by their path in the configuration file
+func sensitiveSettings(settings *SettingsConf) map[string]reflect.Value {
+	var found = make(map[string]reflect.Value)
+	collectSensitiveSettings(reflect.ValueOf(settings).Elem(), "", found)
+	return found
+}
+
+func collectSensitiveSettings(value reflect.Value, path string, found map[string]reflect.Value) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		structField := value.Type().Field(i)
+		fieldPath := strings.TrimPrefix(path+"."+yamlKey(structField), ".")
+
+		switch field.Kind() {
+		case reflect.String:
+			if structField.Tag.Get("sensitive") == "true" {
+				found[fieldPath] = field
+			}
+		case reflect.Struct:
+			collectSensitiveSettings(field, fieldPath, found)
+		case reflect.Slice:
+			if field.Type().Elem().Kind() != reflect.Struct {
+				continue
+			}
+			for j := 0; j < field.Len(); j++ {
+				collectSensitiveSettings(field.Index(j), fieldPath+"."+strconv.Itoa(j), found)
+			}
+		}
+	}
+}
+
+// Key of a setting in the configuration file
+func yamlKey(structField reflect.StructField) string {
+	if key := strings.Split(structField.Tag.Get("yaml"), ",")[0]; key != "" {
+		return key
+	}
+	return strings.ToLower(structField.Name)
+}
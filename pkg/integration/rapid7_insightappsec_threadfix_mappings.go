@@ -0,0 +1,120 @@
+package integration
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/insightappsec"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/threadfix"
+)
+
+// Standards recognized by the prefix of attack documentation reference keys, in the order findings list them
+var referenceMappingTypes = []string{threadfix.MappingTypeCWE, threadfix.MappingTypeOWASP,
+	threadfix.MappingTypeCAPEC, threadfix.MappingTypeWASC, threadfix.MappingTypePCI, threadfix.MappingTypeNIST}
+
+// Map the references of a module's attack documentation to standards, ordered by standard and identifier. The first
+// CWE is the primary mapping; when no reference is a CWE, the CWE mapped to the module in CWEMappings is used instead.
+func MapAttackDocumentation(moduleId string, attackDoc insightappsec.AttackDocumentation) []threadfix.Mapping {
+	mappings := []threadfix.Mapping{}
+	mapped := make(map[threadfix.Mapping]bool)
+
+	for key := range attackDoc.References {
+		var mapping = ParseReference(key)
+		if !mapped[mapping] {
+			mapped[mapping] = true
+			mappings = append(mappings, mapping)
+		}
+	}
+	sort.Slice(mappings, func(i, j int) bool {
+		if rank, other := mappingRank(mappings[i]), mappingRank(mappings[j]); rank != other {
+			return rank < other
+		}
+		if mappings[i].MappingType == threadfix.MappingTypeCWE {
+			first, _ := strconv.Atoi(mappings[i].Value)
+			second, _ := strconv.Atoi(mappings[j].Value)
+			return first < second
+		}
+		return mappings[i].Value < mappings[j].Value
+	})
+
+	if len(mappings) == 0 || mappings[0].MappingType != threadfix.MappingTypeCWE {
+		for _, cweMapping := range CWEMappings {
+			if cwe, ok := ParseCWE(cweMapping.CWE); ok && strings.EqualFold(cweMapping.Module, moduleId) {
+				mappings = append([]threadfix.Mapping{{MappingType: threadfix.MappingTypeCWE, Value: cwe}}, mappings...)
+				break
+			}
+		}
+	}
+
+	// Only label a single CWE instance as primary
+	if len(mappings) > 0 && mappings[0].MappingType == threadfix.MappingTypeCWE {
+		mappings[0].Primary = true
+	}
+	return mappings
+}
+
+// Parse an attack documentation reference key such as CWE-89, CWE89, OWASP-2017-A1, or PCI 6.5.1 into the standard
+// and identifier it refers to. The standard's name must be followed by a separator or digit, so OWASPZAP-1 is not an
+// OWASP reference. Keys of other standards are mapped as the scanner's own.
+func ParseReference(key string) threadfix.Mapping {
+	var trimmed = strings.TrimSpace(key)
+	for _, mappingType := range referenceMappingTypes {
+		if len(trimmed) <= len(mappingType) || !strings.EqualFold(trimmed[:len(mappingType)], mappingType) ||
+			!referenceBoundary(mappingType, trimmed[len(mappingType):]) {
+			continue
+		}
+		var value = trimReferenceSeparators(trimmed[len(mappingType):])
+		if mappingType == threadfix.MappingTypeCWE {
+			if cwe, ok := ParseCWE(trimmed); ok {
+				return threadfix.Mapping{MappingType: mappingType, Value: cwe}
+			}
+			continue
+		}
+		if mappingType == threadfix.MappingTypePCI && len(value) > 3 && strings.EqualFold(value[:3], "DSS") {
+			value = trimReferenceSeparators(value[3:])
+		}
+		if value != "" {
+			return threadfix.Mapping{MappingType: mappingType, Value: value}
+		}
+	}
+
+	var vendorType = strings.Split(key, "-")
+	return threadfix.Mapping{MappingType: threadfix.ToolVendor, Value: key, VendorOtherType: vendorType[0]}
+}
+
+// Parse a CWE such as 89, CWE-89, or CWE89 into its number
+func ParseCWE(value string) (string, bool) {
+	var trimmed = strings.TrimSpace(value)
+	if len(trimmed) >= len(threadfix.MappingTypeCWE) &&
+		strings.EqualFold(trimmed[:len(threadfix.MappingTypeCWE)], threadfix.MappingTypeCWE) {
+		trimmed = trimReferenceSeparators(trimmed[len(threadfix.MappingTypeCWE):])
+	}
+	number, err := strconv.Atoi(trimmed)
+	if err != nil || number <= 0 {
+		return "", false
+	}
+	return strconv.Itoa(number), true
+}
+
+// Whether the rest of a reference key after a standard's name starts a new word: a separator, a digit, or for PCI the
+// DSS of PCIDSS
+func referenceBoundary(mappingType string, rest string) bool {
+	if strings.ContainsRune("-_: 0123456789", rune(rest[0])) {
+		return true
+	}
+	return mappingType == threadfix.MappingTypePCI && len(rest) > 3 && strings.EqualFold(rest[:3], "DSS")
+}
+
+func trimReferenceSeparators(value string) string {
+	return strings.TrimLeft(value, "-_: ")
+}
+
+func mappingRank(mapping threadfix.Mapping) int {
+	for index, mappingType := range referenceMappingTypes {
+		if mapping.MappingType == mappingType {
+			return index
+		}
+	}
+	return len(referenceMappingTypes)
+}
@@ -0,0 +1,314 @@
+package integration
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/insightappsec"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/shared/logging"
+)
+
+// Version of the integration recorded in scan metadata
+var ToolVersion string
+
+// Fields available to metadata templates, e.g. {{.AppName}}; the vulnerability fields are only set for findings
+type MetadataFields struct {
+	ToolVersion         string
+	AppID               string
+	AppName             string
+	AppLink             string
+	ScanID              string
+	ScanLink            string
+	ScanConfigID        string
+	ScanConfigName      string
+	AttackTemplateID    string
+	AttackTemplateName  string
+	SubmitterType       string
+	ScanStatus          string
+	SubmitTime          string
+	CompletionTime      string
+	ScanDuration        string
+	VulnerabilityID     string
+	VulnerabilityLink   string
+	VulnerabilityStatus string
+}
+
+// Metadata recorded on every uploaded scan unless replaced by an export configuration
+var DefaultScanMetadata = []MetadataTemplate{
+	{Key: "InsightAppSec Application", Template: "{{.AppName}}"},
+	{Key: "InsightAppSec Application ID", Template: "{{.AppID}}"},
+	{Key: "InsightAppSec Scan ID", Template: "{{.ScanID}}"},
+	{Key: "InsightAppSec Scan Config", Template: "{{.ScanConfigName}}"},
+	{Key: "InsightAppSec Attack Template", Template: "{{.AttackTemplateName}}"},
+	{Key: "InsightAppSec Submitter", Template: "{{.SubmitterType}}"},
+	{Key: "InsightAppSec Scan Status", Template: "{{.ScanStatus}}"},
+	{Key: "InsightAppSec Scan Duration", Template: "{{.ScanDuration}}"},
+	{Key: "InsightAppSec Scan Link", Template: "{{.ScanLink}}"},
+	{Key: "Integration Version", Template: "{{.ToolVersion}}"},
+}
+
+// Metadata recorded on every uploaded finding unless replaced by an export configuration
+var DefaultFindingMetadata = []MetadataTemplate{
+	{Key: "InsightAppSec Vulnerability Status", Template: "{{.VulnerabilityStatus}}"},
+	{Key: "InsightAppSec Vulnerability Link", Template: "{{.VulnerabilityLink}}"},
+}
+
+// Compiled metadata templates, in the order their keys were first configured
+type metadataTemplates struct {
+	keys      []string
+	templates []*template.Template
+}
+
+// Compile the default templates with the configured templates replacing those of the same key
+func newMetadataTemplates(defaults []MetadataTemplate, configured []MetadataTemplate) (*metadataTemplates, error) {
+	var merged []MetadataTemplate
+	for _, metadataTemplate := range append(append([]MetadataTemplate{}, defaults...), configured...) {
+		var replaced = false
+		for index := range merged {
+			if strings.EqualFold(merged[index].Key, metadataTemplate.Key) {
+				merged[index].Template = metadataTemplate.Template
+				replaced = true
+			}
+		}
+		if !replaced {
+			merged = append(merged, metadataTemplate)
+		}
+	}
+
+	var templates = &metadataTemplates{}
+	for _, metadataTemplate := range merged {
+		if metadataTemplate.Template == "" {
+			continue
+		}
+		compiled, err := parseMetadataTemplate(metadataTemplate)
+		if err != nil {
+			return nil, err
+		}
+		templates.keys = append(templates.keys, metadataTemplate.Key)
+		templates.templates = append(templates.templates, compiled)
+	}
+	return templates, nil
+}
+
+// Parse a metadata template, verifying it only refers to known fields
+func parseMetadataTemplate(metadataTemplate MetadataTemplate) (*template.Template, error) {
+	if strings.TrimSpace(metadataTemplate.Key) == "" {
+		return nil, errors.New("metadata key is required")
+	}
+	compiled, err := template.New(metadataTemplate.Key).Parse(metadataTemplate.Template)
+	if err == nil {
+		err = compiled.Execute(ioutil.Discard, MetadataFields{})
+	}
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid template for metadata %q: %s", metadataTemplate.Key, err))
+	}
+	return compiled, nil
+}
+
+func (templates *metadataTemplates) empty() bool {
+	return templates == nil || len(templates.templates) == 0
+}
+
+// Render the metadata, omitting keys whose value is empty
+func (templates *metadataTemplates) render(fields MetadataFields) map[string]string {
+	if templates.empty() {
+		return nil
+	}
+
+	var metadata = make(map[string]string)
+	for index, compiled := range templates.templates {
+		var value bytes.Buffer
+		if err := compiled.Execute(&value, fields); err != nil {
+			logging.Logger.Errorf("Error rendering metadata %q: %s", templates.keys[index], err)
+			continue
+		}
+		if value.Len() > 0 {
+			metadata[templates.keys[index]] = value.String()
+		}
+	}
+	return metadata
+}
+
+// Metadata fields of a scan, fetching the names of its app, scan config, and attack template from InsightAppSec
+func scanMetadataFields(scan insightappsec.Scan) MetadataFields {
+	var fields = MetadataFields{
+		ToolVersion:   ToolVersion,
+		AppID:         scan.App.ID,
+		ScanID:        scan.ID,
+		ScanConfigID:  scan.ScanConfig.ID,
+		SubmitterType: scan.Submitter.Type,
+		ScanStatus:    scan.Status,
+	}
+
+	if scan.App.ID != "" {
+		if app, err := cachedApp(scan.App.ID); err == nil {
+			fields.AppName = app.Name
+		}
+		fields.AppLink = IasClient.ConsoleUrl("apps/" + scan.App.ID)
+		if scan.ID != "" {
+			fields.ScanLink = IasClient.ConsoleUrl(fmt.Sprintf("apps/%s/scans/%s", scan.App.ID, scan.ID))
+		}
+	}
+	if scan.ScanConfig.ID != "" {
+		if scanConfig, err := cachedScanConfig(scan.ScanConfig.ID); err == nil {
+			fields.ScanConfigName = scanConfig.Name
+			fields.AttackTemplateID = scanConfig.AttackTemplate.ID
+		}
+	}
+	if fields.AttackTemplateID != "" {
+		if attackTemplate, err := cachedAttackTemplate(fields.AttackTemplateID); err == nil {
+			fields.AttackTemplateName = attackTemplate.Name
+		}
+	}
+
+	submitted, submitErr := parseScanTime(scan.SubmitTime)
+	if submitErr == nil {
+		fields.SubmitTime = submitted.Format(time.RFC3339)
+	}
+	completed, completeErr := parseScanTime(scan.CompletionTime)
+	if completeErr == nil {
+		fields.CompletionTime = completed.Format(time.RFC3339)
+	}
+	if submitErr == nil && completeErr == nil && !completed.Before(submitted) {
+		fields.ScanDuration = completed.Sub(submitted).Round(time.Second).String()
+	}
+	return fields
+}
+
+// Executive summary of a scan shown in Threadfix, describing what was scanned and when along with the IDs to find
+// the scan in InsightAppSec, e.g. "InsightAppSec scan of Hackazon with scan config Hackazon Full Scan (attack template
+// All Modules), COMPLETE at 2019-08-05T18:13:56Z after 3m39s. Application ID: ..., Scan ID: ..."
+func executiveSummary(scan insightappsec.Scan, fields MetadataFields) string {
+	var summary = "InsightAppSec scan"
+	if fields.AppName != "" {
+		summary += " of " + fields.AppName
+	}
+	if fields.ScanConfigName != "" {
+		summary += " with scan config " + fields.ScanConfigName
+	}
+	if fields.AttackTemplateName != "" {
+		summary += fmt.Sprintf(" (attack template %s)", fields.AttackTemplateName)
+	}
+	if fields.ScanStatus != "" {
+		summary += ", " + fields.ScanStatus
+	}
+	if fields.CompletionTime != "" {
+		summary += " at " + fields.CompletionTime
+	}
+	if fields.ScanDuration != "" {
+		summary += " after " + fields.ScanDuration
+	}
+	return summary + fmt.Sprintf(". Application ID: %s, Scan ID: %s", scan.App.ID, scan.ID)
+}
+
+// InsightAppSec data fetched during a run, by ID, so each scan config, app, and attack template is fetched once per run
+// rather than for every scan; InsightAppSec only lists scan configs all at once. Failed fetches are never cached.
+var runCache = struct {
+	sync.Mutex
+	scanConfigs        map[string]insightappsec.ScanConfig
+	missingScanConfigs map[string]bool
+	apps               map[string]insightappsec.Application
+	attackTemplates    map[string]insightappsec.AttackTemplate
+}{}
+
+// Begin a run with no InsightAppSec data fetched
+func ResetRunCache() {
+	runCache.Lock()
+	defer runCache.Unlock()
+	runCache.scanConfigs = nil
+	runCache.missingScanConfigs = make(map[string]bool)
+	runCache.apps = make(map[string]insightappsec.Application)
+	runCache.attackTemplates = make(map[string]insightappsec.AttackTemplate)
+}
+
+// Scan config with the ID, fetching every scan config on first use in the run and again for a scan config created
+// since. Returns the error of a failed fetch, and the zero value for a scan config InsightAppSec no longer has.
+func cachedScanConfig(id string) (insightappsec.ScanConfig, error) {
+	runCache.Lock()
+	defer runCache.Unlock()
+
+	if scanConfig, ok := runCache.scanConfigs[id]; ok {
+		return scanConfig, nil
+	}
+	if runCache.missingScanConfigs[id] {
+		return insightappsec.ScanConfig{}, nil
+	}
+
+	var scanConfigs, err = IasClient.GetScanConfigs()
+	if err != nil {
+		return insightappsec.ScanConfig{}, err
+	}
+	runCache.scanConfigs = make(map[string]insightappsec.ScanConfig)
+	for _, scanConfig := range scanConfigs {
+		runCache.scanConfigs[scanConfig.ID] = scanConfig
+	}
+	if scanConfig, ok := runCache.scanConfigs[id]; ok {
+		return scanConfig, nil
+	}
+	logging.Logger.Warnf("Scan config %s not found in InsightAppSec; it may have been deleted", id)
+	if runCache.missingScanConfigs == nil {
+		runCache.missingScanConfigs = make(map[string]bool)
+	}
+	runCache.missingScanConfigs[id] = true
+	return insightappsec.ScanConfig{}, nil
+}
+
+// App with the ID, fetched once per run
+func cachedApp(id string) (insightappsec.Application, error) {
+	runCache.Lock()
+	defer runCache.Unlock()
+
+	if app, ok := runCache.apps[id]; ok {
+		return app, nil
+	}
+	app, err := IasClient.GetAppById(id)
+	if err != nil {
+		return app, err
+	}
+	if runCache.apps == nil {
+		runCache.apps = make(map[string]insightappsec.Application)
+	}
+	runCache.apps[id] = app
+	return app, nil
+}
+
+// Attack template with the ID, fetched once per run
+func cachedAttackTemplate(id string) (insightappsec.AttackTemplate, error) {
+	runCache.Lock()
+	defer runCache.Unlock()
+
+	if attackTemplate, ok := runCache.attackTemplates[id]; ok {
+		return attackTemplate, nil
+	}
+	attackTemplate, err := IasClient.GetAttackTemplate(id)
+	if err != nil {
+		return attackTemplate, err
+	}
+	if runCache.attackTemplates == nil {
+		runCache.attackTemplates = make(map[string]insightappsec.AttackTemplate)
+	}
+	runCache.attackTemplates[id] = attackTemplate
+	return attackTemplate, nil
+}
+
+// Metadata fields of a vulnerability found by the scan of these fields
+func (fields MetadataFields) withVulnerability(vulnerability insightappsec.Vulnerability) MetadataFields {
+	fields.VulnerabilityID = vulnerability.ID
+	fields.VulnerabilityStatus = vulnerability.Status
+
+	var appId = vulnerability.App.ID
+	if appId == "" {
+		appId = fields.AppID
+	}
+	if appId != "" && vulnerability.ID != "" {
+		fields.VulnerabilityLink = IasClient.ConsoleUrl(fmt.Sprintf("apps/%s/vulnerabilities/%s", appId,
+			vulnerability.ID))
+	}
+	return fields
+}
@@ -0,0 +1,64 @@
+package integration
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/insightappsec"
+)
+
+// InsightAppSec apps in scope of an export configuration: those matching its app query when set, otherwise those
+// whose name matches the application filter
+func scopedApps(appFilter string, exportConfiguration ExportConfiguration) []insightappsec.Application {
+	if exportConfiguration.AppQuery != "" {
+		return IasClient.SearchApps(exportConfiguration.AppQuery)
+	}
+	return IasClient.GetAppsByName(appFilter)
+}
+
+// Scans of an InsightAppSec app, limited by the scan query of the export configuration when set; most recent first
+func scopedScans(appId string, exportConfiguration ExportConfiguration) []insightappsec.Scan {
+	var query = fmt.Sprintf("scan.app.id=%s", insightappsec.QuoteSearchValue(appId))
+	if exportConfiguration.ScanQuery != "" {
+		query = fmt.Sprintf("%s && (%s)", query, exportConfiguration.ScanQuery)
+	}
+	return IasClient.SearchScans(query)
+}
+
+// Limit an export configuration to a single InsightAppSec app, e.g. when mapping applications by name
+func scopeToApp(exportConfiguration ExportConfiguration, app insightappsec.Application) ExportConfiguration {
+	exportConfiguration.ApplicationScope = app.Name
+	if exportConfiguration.AppQuery != "" {
+		exportConfiguration.AppQuery = fmt.Sprintf("app.id=%s", insightappsec.QuoteSearchValue(app.ID))
+	}
+	return exportConfiguration
+}
+
+// Check that the quotes and parentheses of a search query are balanced; the query is otherwise checked by InsightAppSec
+func checkSearchQuery(query string) error {
+	var depth = 0
+	var quoted = false
+	for index := 0; index < len(query); index++ {
+		switch character := query[index]; {
+		case quoted && character == '\\':
+			index++
+		case character == '\'':
+			quoted = !quoted
+		case quoted:
+		case character == '(':
+			depth++
+		case character == ')':
+			depth--
+			if depth < 0 {
+				return errors.New(fmt.Sprintf("unexpected ) at position %d", index+1))
+			}
+		}
+	}
+	if quoted {
+		return errors.New("unterminated quoted value")
+	}
+	if depth > 0 {
+		return errors.New("unclosed (")
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package integration
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const RedactedValue = "[REDACTED]"
+
+// Appended to truncated bodies with the number of bytes removed
+const TruncatedMarker = "[TRUNCATED %d BYTES]"
+
+// Redaction of export configurations without redaction settings, so credentials are never uploaded by default
+var DefaultRedaction = RedactionConf{Headers: []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}}
+
+// Redaction applied by an export configuration: its own settings, DefaultRedaction when it has none, or nothing when
+// redaction is disabled
+func EffectiveRedaction(redaction RedactionConf) RedactionConf {
+	if redaction.Disabled {
+		return RedactionConf{}
+	}
+	if len(redaction.Headers) == 0 && len(redaction.Patterns) == 0 && redaction.MaxBodyLength == 0 {
+		return DefaultRedaction
+	}
+	return redaction
+}
+
+// Redacts the attack requests and responses of findings according to an export configuration's redaction settings
+type Redactor struct {
+	headers       map[string]bool
+	patterns      []*regexp.Regexp
+	maxBodyLength int
+}
+
+// Compile the redaction settings; returns nil when nothing is redacted
+func NewRedactor(redaction RedactionConf) (*Redactor, error) {
+	if len(redaction.Headers) == 0 && len(redaction.Patterns) == 0 && redaction.MaxBodyLength <= 0 {
+		return nil, nil
+	}
+
+	var redactor = &Redactor{headers: make(map[string]bool), maxBodyLength: redaction.MaxBodyLength}
+	for _, header := range redaction.Headers {
+		redactor.headers[strings.ToLower(strings.TrimSpace(header))] = true
+	}
+	for _, pattern := range redaction.Patterns {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid redaction pattern %q: %s", pattern, err))
+		}
+		redactor.patterns = append(redactor.patterns, compiled)
+	}
+	return redactor, nil
+}
+
+// Redact the values of deny-listed headers and matches of the patterns from an HTTP request or response, then
+// truncate its body. Patterns with capture groups redact only the captured text.
+func (redactor *Redactor) Redact(message string) string {
+	if redactor == nil || message == "" {
+		return message
+	}
+
+	head, separator, body := splitMessage(message)
+	head = redactor.redactPatterns(redactor.redactHeaders(head))
+	body = redactor.redactPatterns(body)
+
+	if redactor.maxBodyLength > 0 && len(body) > redactor.maxBodyLength {
+		// Never split a multi-byte character
+		var length = redactor.maxBodyLength
+		for length > 0 && !utf8.RuneStart(body[length]) {
+			length--
+		}
+		body = body[:length] + "\n" + fmt.Sprintf(TruncatedMarker, len(body)-length)
+	}
+	return head + separator + body
+}
+
+// Split an HTTP message into its start line and headers, the blank line separating them from the body, and the body
+func splitMessage(message string) (string, string, string) {
+	for _, separator := range []string{"\r\n\r\n", "\n\n"} {
+		if index := strings.Index(message, separator); index >= 0 {
+			return message[:index], separator, message[index+len(separator):]
+		}
+	}
+
+	// Without a blank line, the message is only headers when it starts with a request or status line
+	var startLine = strings.SplitN(message, "\n", 2)[0]
+	if strings.Contains(startLine, "HTTP/") {
+		return message, "", ""
+	}
+	return "", "", message
+}
+
+func (redactor *Redactor) redactHeaders(head string) string {
+	if len(redactor.headers) == 0 {
+		return head
+	}
+
+	var lines = strings.Split(head, "\n")
+	// The first line is the request or status line
+	for index := 1; index < len(lines); index++ {
+		var colon = strings.Index(lines[index], ":")
+		if colon < 0 || !redactor.headers[strings.ToLower(strings.TrimSpace(lines[index][:colon]))] {
+			continue
+		}
+		var lineEnd = ""
+		if strings.HasSuffix(lines[index], "\r") {
+			lineEnd = "\r"
+		}
+		lines[index] = lines[index][:colon+1] + " " + RedactedValue + lineEnd
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (redactor *Redactor) redactPatterns(text string) string {
+	for _, pattern := range redactor.patterns {
+		if pattern.NumSubexp() == 0 {
+			text = pattern.ReplaceAllLiteralString(text, RedactedValue)
+			continue
+		}
+
+		// Replace each captured group, keeping the rest of the match
+		var redacted strings.Builder
+		var last = 0
+		for _, match := range pattern.FindAllStringSubmatchIndex(text, -1) {
+			for group := 2; group < len(match); group += 2 {
+				if match[group] < last {
+					continue
+				}
+				redacted.WriteString(text[last:match[group]])
+				redacted.WriteString(RedactedValue)
+				last = match[group+1]
+			}
+		}
+		redacted.WriteString(text[last:])
+		text = redacted.String()
+	}
+	return text
+}
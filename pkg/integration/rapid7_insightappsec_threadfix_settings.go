@@ -0,0 +1,237 @@
+package integration
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/shared"
+	"gopkg.in/yaml.v2"
+)
+
+// Prefix of environment variables overriding configuration settings, e.g. R7_IAS_TF_CONNECTIONS_THREADFIX_HOST
+const EnvironmentPrefix = "R7_IAS_TF"
+
+// Set a configuration value by its dotted path, e.g. connections.threadfix.host or exportconfigurations.Hackazon
+// Import.enabled. Lists and nested settings accept a YAML or JSON value. Sensitive values are encrypted unless they
+// reference a secret stored elsewhere.
+func SetConfigurationValue(settings *SettingsConf, path string, value string) error {
+	field, sensitive, err := lookupSetting(reflect.ValueOf(settings).Elem(), strings.Split(path, "."))
+	if err != nil {
+		return errors.New(fmt.Sprintf("unknown setting %s: %s", path, err))
+	}
+
+	if sensitive && value != "" && !shared.IsEncrypted(value) && !shared.IsSecretReference(value) {
+		value = shared.Encrypt(value)
+	}
+	if err := assignSetting(field, value); err != nil {
+		return errors.New(fmt.Sprintf("invalid value for %s: %s", path, err))
+	}
+	return nil
+}
+
+// Apply a partial configuration document in YAML or JSON on top of the configuration
+func ApplyConfigurationPatch(settings *SettingsConf, patch []byte) error {
+	var document map[interface{}]interface{}
+	if err := yaml.Unmarshal(patch, &document); err != nil {
+		return errors.New(fmt.Sprintf("unable to parse configuration patch: %s", err))
+	}
+	return applyPatch(settings, "", document)
+}
+
+func applyPatch(settings *SettingsConf, prefix string, document map[interface{}]interface{}) error {
+	for key, value := range document {
+		path := fmt.Sprintf("%s%v", prefix, key)
+
+		// Merge nested settings so a patch only changes the values it contains
+		if nested, ok := value.(map[interface{}]interface{}); ok {
+			field, _, err := lookupSetting(reflect.ValueOf(settings).Elem(), strings.Split(path, "."))
+			if err == nil && field.Kind() == reflect.Struct {
+				if err := applyPatch(settings, path+".", nested); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		var stringValue string
+		switch value.(type) {
+		case map[interface{}]interface{}, []interface{}:
+			encoded, err := yaml.Marshal(value)
+			if err != nil {
+				return err
+			}
+			stringValue = string(encoded)
+		case nil:
+			stringValue = ""
+		default:
+			stringValue = fmt.Sprintf("%v", value)
+		}
+
+		if err := SetConfigurationValue(settings, path, stringValue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Override configuration settings from environment variables named by the setting's path, e.g.
+// R7_IAS_TF_CONNECTIONS_INSIGHTAPPSEC_APIKEY, R7_IAS_TF_EXPORTCONFIGURATIONS_0_ENABLED or R7_IAS_TF_SEVERITYMAPPINGS
+func ApplyEnvironmentOverrides(settings *SettingsConf) error {
+	return applyEnvironment(reflect.ValueOf(settings).Elem(), EnvironmentPrefix)
+}
+
+func applyEnvironment(value reflect.Value, name string) error {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		envName := name + "_" + strings.ToUpper(value.Type().Field(i).Name)
+
+		if envValue, ok := os.LookupEnv(envName); ok {
+			if err := assignSetting(field, envValue); err != nil {
+				return errors.New(fmt.Sprintf("invalid value for %s: %s", envName, err))
+			}
+		}
+
+		switch field.Kind() {
+		case reflect.Struct:
+			if err := applyEnvironment(field, envName); err != nil {
+				return err
+			}
+		case reflect.Slice:
+			if field.Type().Elem().Kind() != reflect.Struct {
+				continue
+			}
+			for j := 0; j < field.Len(); j++ {
+				if err := applyEnvironment(field.Index(j), envName+"_"+strconv.Itoa(j)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Find the field for a setting path; fields match by name or YAML key, ignoring case and underscores, and list
+// entries match by index or name
+func lookupSetting(value reflect.Value, segments []string) (reflect.Value, bool, error) {
+	var sensitive bool
+
+	for _, segment := range segments {
+		switch value.Kind() {
+		case reflect.Struct:
+			var found = false
+			for i := 0; i < value.NumField(); i++ {
+				structField := value.Type().Field(i)
+				yamlKey := strings.Split(structField.Tag.Get("yaml"), ",")[0]
+				if normalizeKey(segment) == normalizeKey(structField.Name) ||
+					normalizeKey(segment) == normalizeKey(yamlKey) {
+					value = value.Field(i)
+					sensitive = structField.Tag.Get("sensitive") == "true"
+					found = true
+					break
+				}
+			}
+			if !found {
+				return value, false, errors.New(fmt.Sprintf("no setting named %s", segment))
+			}
+		case reflect.Slice:
+			element, err := lookupElement(value, segment)
+			if err != nil {
+				return value, false, err
+			}
+			value = element
+		default:
+			return value, false, errors.New(fmt.Sprintf("%s is not a nested setting", segment))
+		}
+	}
+	return value, sensitive, nil
+}
+
+func lookupElement(slice reflect.Value, segment string) (reflect.Value, error) {
+	if index, err := strconv.Atoi(segment); err == nil {
+		if index < 0 || index >= slice.Len() {
+			return slice, errors.New(fmt.Sprintf("index %d out of range", index))
+		}
+		return slice.Index(index), nil
+	}
+
+	for i := 0; i < slice.Len(); i++ {
+		element := slice.Index(i)
+		if element.Kind() == reflect.Struct {
+			if name := element.FieldByName("Name"); name.IsValid() && name.String() == segment {
+				return element, nil
+			}
+		}
+	}
+	return slice, errors.New(fmt.Sprintf("no entry named %s", segment))
+}
+
+func assignSetting(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(parsed)
+	case reflect.Int:
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(parsed))
+	default:
+		// Lists, maps, and nested settings are provided as YAML or JSON
+		parsed := reflect.New(field.Type())
+		if err := yaml.Unmarshal([]byte(value), parsed.Interface()); err != nil {
+			return err
+		}
+		field.Set(parsed.Elem())
+	}
+	return nil
+}
+
+func normalizeKey(key string) string {
+	return strings.ToLower(strings.Replace(key, "_", "", -1))
+}
+
+// Add an export configuration, failing if one with the same name already exists
+func AddExportConfiguration(settings *SettingsConf, exportConfiguration ExportConfiguration) error {
+	if exportConfiguration.Name == "" {
+		return errors.New("export configuration name is required")
+	}
+	for _, existing := range settings.ExportConfigurations {
+		if existing.Name == exportConfiguration.Name {
+			return errors.New(fmt.Sprintf("export configuration %s already exists", exportConfiguration.Name))
+		}
+	}
+	settings.ExportConfigurations = append(settings.ExportConfigurations, exportConfiguration)
+	return nil
+}
+
+func RemoveExportConfiguration(settings *SettingsConf, name string) error {
+	for index, existing := range settings.ExportConfigurations {
+		if existing.Name == name {
+			settings.ExportConfigurations = append(settings.ExportConfigurations[:index],
+				settings.ExportConfigurations[index+1:]...)
+			return nil
+		}
+	}
+	return errors.New(fmt.Sprintf("export configuration %s does not exist", name))
+}
+
+// TLS and proxy settings of a connection for its API client
+func TransportConfiguration(proxy string, tls TLSConf) shared.TransportConfiguration {
+	return shared.TransportConfiguration{
+		CABundle:           tls.CABundle,
+		ClientCertificate:  tls.ClientCertificate,
+		ClientKey:          tls.ClientKey,
+		InsecureSkipVerify: tls.InsecureSkipVerify,
+		Proxy:              proxy,
+	}
+}
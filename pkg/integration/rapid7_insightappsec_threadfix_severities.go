@@ -0,0 +1,101 @@
+package integration
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/threadfix"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/shared/logging"
+)
+
+// Resolve the Threadfix severities of the severity mappings and the unmapped severity default against the severities
+// defined in Threadfix, so findings are uploaded with the severity's current name. Mappings with an int value are
+// resolved by it, so a severity renamed in Threadfix is still mapped; other mappings are resolved by name, display
+// name, or custom name. Threadfix API versions without severities are not resolved.
+func ResolveSeverityMappings() error {
+	if !ThreadfixClient.SupportsSeverities() {
+		logging.Logger.Info("Threadfix API version does not list severities; severity mappings are not resolved")
+		return nil
+	}
+	severities, err := ThreadfixClient.ListSeverities()
+	if err != nil || !severities.Success {
+		return errors.New(fmt.Sprintf("unable to list Threadfix severities: %s", threadfixFailure(err,
+			severities.Message)))
+	}
+
+	var unresolved = resolveSeverities(severities.SeveritiesMetadata, SeverityMappings, &UnmappedSeverity)
+	if len(unresolved) > 0 {
+		return errors.New(fmt.Sprintf("Threadfix severities do not exist in Threadfix: %s",
+			strings.Join(unresolved, ", ")))
+	}
+	return nil
+}
+
+// Resolve the severity mappings of a configuration against the severities defined in Threadfix, storing the current
+// name and int value of each mapping's severity so the configuration file keeps mapping a severity after it is
+// renamed in Threadfix. Nothing is changed when a severity does not resolve.
+func SyncSeverityMappings(settings *SettingsConf, severities []threadfix.VulnerabilitySeverity) error {
+	var severityMappings = append([]SeverityMapping{}, settings.SeverityMappings...)
+	var unmapped = settings.UnmappedSeverity
+	if unresolved := resolveSeverities(severities, severityMappings, &unmapped); len(unresolved) > 0 {
+		return errors.New(fmt.Sprintf("Threadfix severities do not exist in Threadfix: %s",
+			strings.Join(unresolved, ", ")))
+	}
+	settings.SeverityMappings = severityMappings
+	settings.UnmappedSeverity = unmapped
+	return nil
+}
+
+// Resolve severity mappings and the unmapped severity default in place, returning the severities that do not resolve
+func resolveSeverities(severities []threadfix.VulnerabilitySeverity, severityMappings []SeverityMapping,
+	unmapped *UnmappedSeverityConf) []string {
+	var unresolved []string
+	for index, severityMapping := range severityMappings {
+		severity, ok := ResolveSeverity(severities, severityMapping)
+		if !ok {
+			unresolved = append(unresolved, describeSeverity(severityMapping))
+			continue
+		}
+		if !strings.EqualFold(severity.Name, severityMapping.Threadfix) {
+			logging.Logger.Infof("Mapping InsightAppSec severity %s to Threadfix severity %s (int value %d), "+
+				"configured as %s", severityMapping.InsightAppSec, severity.Name, severity.IntValue,
+				severityMapping.Threadfix)
+		}
+		severityMappings[index].Threadfix = severity.Name
+		severityMappings[index].ThreadfixIntValue = severity.IntValue
+	}
+	if unmapped.Default != "" {
+		severity, ok := ResolveSeverity(severities, SeverityMapping{Threadfix: unmapped.Default})
+		if ok {
+			unmapped.Default = severity.Name
+		} else {
+			unresolved = append(unresolved, fmt.Sprintf("%q (unmapped severity default)", unmapped.Default))
+		}
+	}
+	return unresolved
+}
+
+// The Threadfix severity of a severity mapping, by int value when set and otherwise by name
+func ResolveSeverity(severities []threadfix.VulnerabilitySeverity,
+	severityMapping SeverityMapping) (threadfix.VulnerabilitySeverity, bool) {
+	for _, severity := range severities {
+		if severityMapping.ThreadfixIntValue != 0 {
+			if severity.IntValue == severityMapping.ThreadfixIntValue {
+				return severity, true
+			}
+		} else if strings.EqualFold(severityMapping.Threadfix, severity.Name) ||
+			strings.EqualFold(severityMapping.Threadfix, severity.DisplayName) ||
+			strings.EqualFold(severityMapping.Threadfix, severity.CustomName) {
+			return severity, true
+		}
+	}
+	return threadfix.VulnerabilitySeverity{}, false
+}
+
+func describeSeverity(severityMapping SeverityMapping) string {
+	if severityMapping.ThreadfixIntValue != 0 {
+		return fmt.Sprintf("%q (int value %d)", severityMapping.Threadfix, severityMapping.ThreadfixIntValue)
+	}
+	return fmt.Sprintf("%q", severityMapping.Threadfix)
+}
@@ -0,0 +1,401 @@
+package integration
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/insightappsec"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/threadfix"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/shared"
+	"github.com/robfig/cron/v3"
+)
+
+var insightAppSecSeverities = []string{"SAFE", "INFORMATIONAL", "LOW", "MEDIUM", "HIGH"}
+var insightAppSecStatuses = []string{"UNREVIEWED", "VERIFIED", "FALSE_POSITIVE", "IGNORED", "REMEDIATED", "DUPLICATE"}
+var logLevels = []string{"debug", "info", "error", "fatal"}
+
+// A configuration problem and the setting it was found in
+type ValidationError struct {
+	Setting string
+	Message string
+}
+
+func (validationError ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", validationError.Setting, validationError.Message)
+}
+
+// Statically check the configuration for problems that would otherwise only surface at run time
+func ValidateConfiguration(settings *SettingsConf) []ValidationError {
+	var errors []ValidationError
+	addError := func(setting string, message string, args ...interface{}) {
+		errors = append(errors, ValidationError{Setting: setting, Message: fmt.Sprintf(message, args...)})
+	}
+
+	// Connections
+	insightAppSec := settings.Connections.InsightAppSec
+	// A base URL without the region placeholder does not depend on the region
+	if insightAppSec.BaseURL == "" || strings.Contains(insightAppSec.BaseURL, insightappsec.RegionPlaceholder) ||
+		strings.Contains(insightAppSec.BaseURL, "%s") {
+		if insightAppSec.Region == "" {
+			addError("connections.insightappsec.region", "region is required, e.g. %s",
+				strings.Join(insightappsec.SupportedRegions, ", "))
+		} else if !containsFold(insightappsec.SupportedRegions, insightAppSec.Region) {
+			addError("connections.insightappsec.region", "unsupported region %q; expected one of %s",
+				insightAppSec.Region, strings.Join(insightappsec.SupportedRegions, ", "))
+		}
+	}
+	if insightAppSec.BaseURL != "" {
+		baseUrl, err := url.Parse(insightappsec.BaseUrl(insightAppSec.BaseURL, insightAppSec.Region))
+		if err != nil || (baseUrl.Scheme != "http" && baseUrl.Scheme != "https") || baseUrl.Host == "" {
+			addError("connections.insightappsec.base_url", "base URL %s must be a full URL, e.g. "+
+				"https://gateway.example.com/{region}/ias/v1/", insightAppSec.BaseURL)
+		}
+	}
+	if insightAppSec.ConsoleURL != "" {
+		consoleUrl, err := url.Parse(insightappsec.BaseUrl(insightAppSec.ConsoleURL, insightAppSec.Region))
+		if err != nil || (consoleUrl.Scheme != "http" && consoleUrl.Scheme != "https") || consoleUrl.Host == "" {
+			addError("connections.insightappsec.console_url", "console URL %s must be a full URL, e.g. "+
+				"https://{region}.appsec.insight.rapid7.com/", insightAppSec.ConsoleURL)
+		}
+	}
+	validateApikey("connections.insightappsec.apikey", insightAppSec.Apikey, addError)
+
+	threadfixConnection := settings.Connections.Threadfix
+	if threadfixConnection.BaseURL != "" {
+		if baseUrl, err := url.Parse(threadfixConnection.BaseURL); err != nil ||
+			(baseUrl.Scheme != "http" && baseUrl.Scheme != "https") || baseUrl.Host == "" {
+			addError("connections.threadfix.base_url", "base URL %s must be a full URL, e.g. "+
+				"https://appsec.example.com/threadfix/", threadfixConnection.BaseURL)
+		}
+	} else {
+		if threadfixConnection.Host == "" {
+			addError("connections.threadfix.host", "host is required, e.g. https://threadfix.example.com")
+		} else if hostUrl, err := url.Parse(threadfixConnection.Host); err != nil ||
+			(hostUrl.Scheme != "http" && hostUrl.Scheme != "https") {
+			addError("connections.threadfix.host", "host %s must include the http:// or https:// scheme",
+				threadfixConnection.Host)
+		}
+	}
+	validateApikey("connections.threadfix.apikey", threadfixConnection.Apikey, addError)
+	apiVersion := threadfixConnection.APIVersion
+	if apiVersion != "" && !strings.EqualFold(apiVersion, threadfix.APIVersionAuto) &&
+		!containsFold(threadfix.SupportedVersions(), apiVersion) {
+		addError("connections.threadfix.api_version", "unsupported API version %q; expected %s or one of %s",
+			apiVersion, threadfix.APIVersionAuto, strings.Join(threadfix.SupportedVersions(), ", "))
+	}
+
+	validateTransport("connections.insightappsec", insightAppSec.Proxy, insightAppSec.TLS, addError)
+	validateTransport("connections.threadfix", threadfixConnection.Proxy, threadfixConnection.TLS, addError)
+
+	// Scheduler and logging
+	if _, err := cron.ParseStandard(settings.InternalScheduler); err != nil {
+		addError("internalScheduler", "invalid cron expression %q: %s", settings.InternalScheduler, err)
+	}
+	if !containsFold(logLevels, settings.Logging.Level) {
+		addError("logging.level", "unsupported level %q; expected one of %s", settings.Logging.Level,
+			strings.Join(logLevels, ", "))
+	}
+
+	// Severity mappings
+	mapped := make(map[string]bool)
+	for index, severityMapping := range settings.SeverityMappings {
+		setting := fmt.Sprintf("severityMappings[%d]", index)
+		if !containsFold(insightAppSecSeverities, severityMapping.InsightAppSec) {
+			addError(setting, "unknown InsightAppSec severity %q; expected one of %s",
+				severityMapping.InsightAppSec, strings.Join(insightAppSecSeverities, ", "))
+		}
+		if severityMapping.Threadfix == "" {
+			addError(setting, "no Threadfix severity mapped for InsightAppSec severity %s",
+				severityMapping.InsightAppSec)
+		}
+		cwe, ok := ParseCWE(severityMapping.CWE)
+		if severityMapping.CWE != "" && !ok {
+			addError(setting, "invalid CWE %q; expected a CWE number, e.g. 89 or CWE-89", severityMapping.CWE)
+		}
+		// Mappings are unique by severity and conditions
+		key := strings.ToUpper(severityMapping.InsightAppSec) + "/" + strings.ToLower(severityMapping.Module) + "/" + cwe
+		if mapped[key] {
+			addError(setting, "InsightAppSec severity %s is mapped more than once", severityMapping.InsightAppSec)
+		}
+		mapped[key] = true
+	}
+	unmappedPolicies := []string{UnmappedSeverityPolicyDefault, UnmappedSeverityPolicySkip, UnmappedSeverityPolicyFail}
+	unmapped := settings.UnmappedSeverity
+	if unmapped.Policy != "" && !containsFold(unmappedPolicies, unmapped.Policy) {
+		addError("unmappedSeverity.policy", "unknown policy %q; expected one of %s", unmapped.Policy,
+			strings.Join(unmappedPolicies, ", "))
+	} else if UnmappedPolicy(unmapped) == UnmappedSeverityPolicyDefault && strings.TrimSpace(unmapped.Default) == "" {
+		addError("unmappedSeverity.default", "a Threadfix severity is required by the %s policy",
+			UnmappedSeverityPolicyDefault)
+	}
+	// The skip and default policies handle unmapped severities, so only a partial mapping under the fail policy is an
+	// error
+	for _, severity := range insightAppSecSeverities {
+		if !mapped[severity+"//"] && UnmappedPolicy(unmapped) == UnmappedSeverityPolicyFail {
+			addError("severityMappings", "no mapping for InsightAppSec severity %s; scans with findings of "+
+				"this severity fail to upload", severity)
+		}
+	}
+
+	// CWE mappings
+	cweModules := make(map[string]bool)
+	for index, cweMapping := range settings.CWEMappings {
+		setting := fmt.Sprintf("cweMappings[%d]", index)
+		if strings.TrimSpace(cweMapping.Module) == "" {
+			addError(setting, "InsightAppSec module ID is required")
+		} else if cweModules[strings.ToLower(cweMapping.Module)] {
+			addError(setting, "InsightAppSec module %s is mapped more than once", cweMapping.Module)
+		}
+		cweModules[strings.ToLower(cweMapping.Module)] = true
+		if _, ok := ParseCWE(cweMapping.CWE); !ok {
+			addError(setting, "invalid CWE %q; expected a CWE number, e.g. 89 or CWE-89", cweMapping.CWE)
+		}
+	}
+
+	// Export configurations
+	names := make(map[string]bool)
+	for index, exportConfiguration := range settings.ExportConfigurations {
+		setting := fmt.Sprintf("exportConfigurations[%d]", index)
+		if exportConfiguration.Name != "" {
+			setting = fmt.Sprintf("exportConfigurations[%s]", exportConfiguration.Name)
+		}
+
+		if exportConfiguration.Name == "" {
+			addError(setting, "name is required")
+		} else if names[exportConfiguration.Name] {
+			addError(setting, "name is used by more than one export configuration")
+		}
+		names[exportConfiguration.Name] = true
+
+		if _, err := regexp.Compile(exportConfiguration.ApplicationScope); err != nil {
+			addError(setting+".application_scope", "invalid regular expression %q: %s",
+				exportConfiguration.ApplicationScope, err)
+		}
+		if _, err := regexp.Compile(exportConfiguration.ScanConfigFilter); err != nil {
+			addError(setting+".scan_config_filter", "invalid regular expression %q: %s",
+				exportConfiguration.ScanConfigFilter, err)
+		}
+		if err := checkSearchQuery(exportConfiguration.AppQuery); err != nil {
+			addError(setting+".app_query", "invalid search query %q: %s", exportConfiguration.AppQuery, err)
+		}
+		if err := checkSearchQuery(exportConfiguration.ScanQuery); err != nil {
+			addError(setting+".scan_query", "invalid search query %q: %s", exportConfiguration.ScanQuery, err)
+		}
+		for _, status := range exportConfiguration.ScanStatuses {
+			if strings.TrimSpace(status) == "" {
+				addError(setting+".scan_statuses", "scan status must not be empty")
+			}
+		}
+		if exportConfiguration.InitialImportMaxDays < 0 {
+			addError(setting+".initial_import_max_days", "must not be negative")
+		}
+		if exportConfiguration.ThreadfixTeamName == "" {
+			addError(setting+".threadfix_team_name", "Threadfix team name is required")
+		}
+		if !exportConfiguration.MapApplicationByName && exportConfiguration.ThreadfixApplicationName == "" {
+			addError(setting+".threadfix_application_name", "Threadfix application name is required unless "+
+				"applications are mapped by name")
+		}
+
+		upload := exportConfiguration.Upload
+		uploadModes := []string{UploadModeSingle, UploadModeCompress}
+		if strings.EqualFold(upload.Mode, "split") {
+			// Threadfix closes the vulnerabilities missing from each upload, so the parts of a split scan would close
+			// each other's findings
+			addError(setting+".upload.mode", "splitting scans across uploads is not supported; use %s to reduce "+
+				"the size of large scan files", UploadModeCompress)
+		} else if upload.Mode != "" && !containsFold(uploadModes, upload.Mode) {
+			addError(setting+".upload.mode", "unknown upload mode %q; expected one of %s", upload.Mode,
+				strings.Join(uploadModes, ", "))
+		}
+
+		varianceModes := []string{VarianceModePreferred, VarianceModeFindings, VarianceModeDetails}
+		if exportConfiguration.Variances != "" && !containsFold(varianceModes, exportConfiguration.Variances) {
+			addError(setting+".variances", "unknown variance mode %q; expected one of %s",
+				exportConfiguration.Variances, strings.Join(varianceModes, ", "))
+		}
+
+		redaction := exportConfiguration.Redaction
+		for _, header := range redaction.Headers {
+			if strings.TrimSpace(header) == "" || strings.ContainsAny(header, ": ") {
+				addError(setting+".redaction.headers", "invalid header name %q", header)
+			}
+		}
+		for _, pattern := range redaction.Patterns {
+			if _, err := regexp.Compile(pattern); err != nil {
+				addError(setting+".redaction.patterns", "invalid regular expression %q: %s", pattern, err)
+			}
+		}
+		if redaction.MaxBodyLength < 0 {
+			addError(setting+".redaction.max_body_length", "must not be negative")
+		}
+
+		filters := exportConfiguration.Filters
+		if filters.MinSeverity != "" && !containsFold(insightAppSecSeverities, filters.MinSeverity) {
+			addError(setting+".filters.min_severity", "unknown InsightAppSec severity %q; expected one of %s",
+				filters.MinSeverity, strings.Join(insightAppSecSeverities, ", "))
+		}
+		for _, status := range filters.Statuses {
+			if !containsFold(insightAppSecStatuses, status) {
+				addError(setting+".filters.statuses", "unknown InsightAppSec vulnerability status %q; expected one "+
+					"of %s", status, strings.Join(insightAppSecStatuses, ", "))
+			}
+		}
+		pathFilters := [][]string{filters.IncludePaths, filters.ExcludePaths}
+		for index, field := range []string{"include_paths", "exclude_paths"} {
+			for _, pattern := range pathFilters[index] {
+				if _, err := regexp.Compile(pattern); err != nil {
+					addError(setting+".filters."+field, "invalid regular expression %q: %s", pattern, err)
+				}
+			}
+		}
+		cweFilters := [][]string{filters.IncludeCWEs, filters.ExcludeCWEs}
+		for index, field := range []string{"include_cwes", "exclude_cwes"} {
+			for _, cwe := range cweFilters[index] {
+				if _, ok := ParseCWE(cwe); !ok {
+					addError(setting+".filters."+field, "invalid CWE %q; expected a CWE number, e.g. 89 or CWE-89", cwe)
+				}
+			}
+		}
+
+		for _, metadataTemplate := range exportConfiguration.Metadata.Scan {
+			if _, err := parseMetadataTemplate(metadataTemplate); err != nil {
+				addError(setting+".metadata.scan", "%s", err)
+			}
+		}
+		for _, metadataTemplate := range exportConfiguration.Metadata.Finding {
+			if _, err := parseMetadataTemplate(metadataTemplate); err != nil {
+				addError(setting+".metadata.finding", "%s", err)
+			}
+		}
+	}
+
+	return errors
+}
+
+func validateApikey(setting string, apikey string, addError func(string, string, ...interface{})) {
+	if apikey == "" {
+		addError(setting, "API key is required")
+	} else if _, err := shared.Decrypt(apikey); err != nil {
+		addError(setting, "unable to decrypt API key: %s", err)
+	} else if shared.IsSecretReference(apikey) {
+		if _, err := shared.ResolveSecret(apikey); err != nil {
+			addError(setting, "unable to resolve API key from %s: %s", apikey, err)
+		}
+	}
+}
+
+func validateTransport(setting string, proxy string, tls TLSConf, addError func(string, string, ...interface{})) {
+	if proxy != "" {
+		if proxyUrl, err := url.Parse(proxy); err != nil || proxyUrl.Scheme == "" || proxyUrl.Host == "" {
+			addError(setting+".proxy", "proxy %s must be a full URL, e.g. http://proxy.example.com:3128", proxy)
+		}
+	}
+	for _, file := range []struct{ name, path string }{
+		{"ca_bundle", tls.CABundle},
+		{"client_certificate", tls.ClientCertificate},
+		{"client_key", tls.ClientKey},
+	} {
+		if _, err := os.Stat(file.path); file.path != "" && err != nil {
+			addError(setting+".tls."+file.name, "unable to read %s: %s", file.path, err)
+		}
+	}
+	if (tls.ClientCertificate == "") != (tls.ClientKey == "") {
+		addError(setting+".tls", "both a client certificate and client key are required for mutual TLS")
+	}
+}
+
+// Check the configuration against the InsightAppSec and Threadfix APIs using the injected clients
+func ValidateConnections(settings *SettingsConf) []ValidationError {
+	var errors []ValidationError
+	addError := func(setting string, message string, args ...interface{}) {
+		errors = append(errors, ValidationError{Setting: setting, Message: fmt.Sprintf(message, args...)})
+	}
+
+	if err := IasClient.CheckConnection(); err != nil {
+		addError("connections.insightappsec", "unable to connect to InsightAppSec: %s", err)
+	}
+
+	if err := NegotiateThreadfixVersion(settings.Connections.Threadfix.APIVersion); err != nil {
+		addError("connections.threadfix", "unable to connect to Threadfix: %s", err)
+		// Remaining checks require Threadfix
+		return errors
+	}
+
+	// Severity mappings can only be checked when the Threadfix API version lists severities
+	if ThreadfixClient.SupportsSeverities() {
+		severities, err := ThreadfixClient.ListSeverities()
+		if err != nil || !severities.Success {
+			addError("connections.threadfix", "unable to connect to Threadfix: %s", threadfixFailure(err,
+				severities.Message))
+			// Remaining checks require Threadfix
+			return errors
+		}
+
+		for index, severityMapping := range settings.SeverityMappings {
+			if _, ok := ResolveSeverity(severities.SeveritiesMetadata, severityMapping); !ok {
+				addError(fmt.Sprintf("severityMappings[%d]", index), "Threadfix severity %s does not exist in "+
+					"Threadfix", describeSeverity(severityMapping))
+			}
+		}
+		if _, ok := ResolveSeverity(severities.SeveritiesMetadata,
+			SeverityMapping{Threadfix: settings.UnmappedSeverity.Default}); settings.UnmappedSeverity.Default != "" && !ok {
+			addError("unmappedSeverity.default", "Threadfix severity %q does not exist in Threadfix",
+				settings.UnmappedSeverity.Default)
+		}
+	}
+
+	for _, exportConfiguration := range settings.ExportConfigurations {
+		setting := fmt.Sprintf("exportConfigurations[%s]", exportConfiguration.Name)
+
+		insightappsecApps := scopedApps(exportConfiguration.ApplicationScope, exportConfiguration)
+		if len(insightappsecApps) == 0 && exportConfiguration.AppQuery != "" {
+			addError(setting+".app_query", "no InsightAppSec applications match the query %q",
+				exportConfiguration.AppQuery)
+		} else if len(insightappsecApps) == 0 {
+			addError(setting+".application_scope", "no InsightAppSec applications match %q",
+				exportConfiguration.ApplicationScope)
+		}
+
+		var threadfixAppNames []string
+		if exportConfiguration.MapApplicationByName {
+			for _, app := range insightappsecApps {
+				threadfixAppNames = append(threadfixAppNames, app.Name)
+			}
+		} else {
+			threadfixAppNames = append(threadfixAppNames, exportConfiguration.ThreadfixApplicationName)
+		}
+
+		for _, appName := range threadfixAppNames {
+			threadfixApp, err := ThreadfixClient.GetAppByName(exportConfiguration.ThreadfixTeamName, appName)
+			if err != nil || threadfixApp.AppData.Name == "" {
+				addError(setting, "Threadfix application %q not found in team %q: %s", appName,
+					exportConfiguration.ThreadfixTeamName, threadfixFailure(err, threadfixApp.Message))
+			}
+		}
+	}
+
+	return errors
+}
+
+func threadfixFailure(err error, message string) string {
+	if err != nil {
+		return err.Error()
+	}
+	if message == "" {
+		return "no response message"
+	}
+	return message
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
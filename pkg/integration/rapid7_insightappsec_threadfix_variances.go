@@ -0,0 +1,85 @@
+package integration
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/insightappsec"
+)
+
+// Module confidences from least to most confident; modules of unknown confidence rank below all of them
+var moduleConfidences = []string{"LOW", "MEDIUM", "HIGH"}
+
+// The variance that best demonstrates a vulnerability; see SortVariances
+func PreferredVariance(variances []insightappsec.Variance,
+	confidence func(moduleId string) string) insightappsec.Variance {
+	var sorted = SortVariances(variances, confidence)
+	if len(sorted) == 0 {
+		return insightappsec.Variance{}
+	}
+	return sorted[0]
+}
+
+// Order variances from most to least preferred. Variances with an attack request are preferred, then variances whose
+// module has the highest confidence, then variances with an attack value, then variances with an original request;
+// remaining ties are ordered by module ID, attack ID, and attack value so the order never depends on the order
+// InsightAppSec returns variances in. The confidence of a variance's module is looked up by module ID.
+func SortVariances(variances []insightappsec.Variance,
+	confidence func(moduleId string) string) []insightappsec.Variance {
+	var sorted = append([]insightappsec.Variance{}, variances...)
+	var moduleRanks = make(map[string]int)
+	var rankOf = func(variance insightappsec.Variance) int {
+		if _, ok := moduleRanks[variance.Module.ID]; !ok {
+			moduleRanks[variance.Module.ID] = confidenceRank(confidence(variance.Module.ID))
+		}
+		return varianceRank(variance, moduleRanks[variance.Module.ID])
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if first, second := rankOf(sorted[i]), rankOf(sorted[j]); first != second {
+			return first > second
+		}
+		if sorted[i].Module.ID != sorted[j].Module.ID {
+			return sorted[i].Module.ID < sorted[j].Module.ID
+		}
+		if sorted[i].Attack.ID != sorted[j].Attack.ID {
+			return sorted[i].Attack.ID < sorted[j].Attack.ID
+		}
+		return sorted[i].AttackValue < sorted[j].AttackValue
+	})
+	return sorted
+}
+
+// Rank of a variance by the evidence it carries and its module's confidence rank; an attack request outranks any
+// confidence, which outranks an attack value and an original request
+func varianceRank(variance insightappsec.Variance, confidenceRank int) int {
+	var rank = confidenceRank * 4
+	if len(variance.AttackExchanges) > 0 && variance.AttackExchanges[0].Request != "" {
+		rank = rank + 4*(len(moduleConfidences)+1)
+	}
+	if variance.AttackValue != "" {
+		rank = rank + 2
+	}
+	if variance.OriginalExchange.Request != "" {
+		rank = rank + 1
+	}
+	return rank
+}
+
+// Rank of a module confidence, 0 for modules of unknown confidence
+func confidenceRank(confidence string) int {
+	for index, moduleConfidence := range moduleConfidences {
+		if strings.EqualFold(moduleConfidence, confidence) {
+			return index + 1
+		}
+	}
+	return 0
+}
+
+// Native ID of the finding for a variance; derived from the vulnerability ID and
+// the variance's module, attack, and attack value so it is stable across scans
+func VarianceNativeID(vulnerabilityId string, variance insightappsec.Variance) string {
+	var hash = sha256.Sum256([]byte(variance.Module.ID + "\x00" + variance.Attack.ID + "\x00" + variance.AttackValue))
+	return vulnerabilityId + "-" + hex.EncodeToString(hash[:6])
+}
@@ -4,20 +4,41 @@ type SettingsConf struct {
 	Connections          ConnectionsConf       `yaml:"connections"`
 	ExportConfigurations []ExportConfiguration `yaml:"exportConfigurations"`
 	SeverityMappings     []SeverityMapping     `yaml:"severityMappings"`
+	UnmappedSeverity     UnmappedSeverityConf  `yaml:"unmappedSeverity"`
+	CWEMappings          []CWEMapping          `yaml:"cweMappings"`
 	InternalScheduler    string                `yaml:"internalScheduler"`
+	ShutdownTimeout      int                   `yaml:"shutdownTimeout"`
 	Logging              LoggingConf           `yaml:"logging"`
 	Metrics              MetricsConf           `yaml:"metrics"`
+	Checkpoints          CheckpointConf        `yaml:"checkpoints"`
 }
 
 type InsightAppSecConnection struct {
-	Region string `yaml:"region"`
-	Apikey string `yaml:"apikey"`
+	Region  string  `yaml:"region"`
+	BaseURL string  `yaml:"base_url"`
+	Apikey  string  `yaml:"apikey" sensitive:"true"`
+	Proxy   string  `yaml:"proxy"`
+	TLS     TLSConf `yaml:"tls"`
+	// Console URL used to link uploaded scans and findings back to InsightAppSec
+	ConsoleURL string `yaml:"console_url"`
 }
 
 type ThreadfixConnection struct {
-	Host   string `yaml:"host"`
-	Port   string `yaml:"port"`
-	Apikey string `yaml:"apikey"`
+	Host    string  `yaml:"host"`
+	Port    string  `yaml:"port"`
+	BaseURL string  `yaml:"base_url"`
+	Apikey  string  `yaml:"apikey" sensitive:"true"`
+	Proxy   string  `yaml:"proxy"`
+	TLS     TLSConf `yaml:"tls"`
+	// Threadfix API version, or auto to detect it
+	APIVersion string `yaml:"api_version"`
+}
+
+type TLSConf struct {
+	CABundle           string `yaml:"ca_bundle"`
+	ClientCertificate  string `yaml:"client_certificate"`
+	ClientKey          string `yaml:"client_key"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
 }
 
 type ConnectionsConf struct {
@@ -38,19 +59,102 @@ type MetricsConf struct {
 	Pretty    bool   `yaml:"pretty"`
 }
 
+type CheckpointConf struct {
+	Directory string `yaml:"directory"`
+}
+
 type SeverityMapping struct {
 	Threadfix     string `yaml:"threadfix"`
 	InsightAppSec string `yaml:"insightappsec"`
+	// Int value of the Threadfix severity, which identifies it when the severity is renamed in Threadfix; resolved
+	// from the Threadfix severity name when not set
+	ThreadfixIntValue int `yaml:"threadfix_int_value,omitempty"`
+	// Optional conditions on the finding's module ID and primary CWE; mappings with conditions take precedence over
+	// mappings without for the findings they match
+	Module string `yaml:"module,omitempty"`
+	CWE    string `yaml:"cwe,omitempty"`
+}
+
+// What happens to findings whose InsightAppSec severity is not mapped to a Threadfix severity
+type UnmappedSeverityConf struct {
+	// default, skip, or fail; defaults to default when a default severity is set and to skip otherwise
+	Policy string `yaml:"policy"`
+	// Threadfix severity of unmapped findings under the default policy; required by the default policy
+	Default string `yaml:"default"`
+}
+
+// CWE of findings of an InsightAppSec module whose attack documentation does not reference a CWE
+type CWEMapping struct {
+	Module string `yaml:"module"`
+	CWE    string `yaml:"cwe"`
 }
 
 type ExportConfiguration struct {
-	Name                     string `yaml:"name"`
-	Enabled                  bool   `yaml:"enabled"`
-	ApplicationScope         string `yaml:"application_scope"`
-	ScanConfigFilter         string `yaml:"scan_config_filter"`
-	LastScanOnly             bool   `yaml:"last_scan_only"`
-	InitialImportMaxDays     int    `yaml:"initial_import_max_days"`
-	MapApplicationByName     bool   `yaml:"map_application_by_name"`
-	ThreadfixApplicationName string `yaml:"threadfix_application_name"`
-	ThreadfixTeamName        string `yaml:"threadfix_team_name"`
+	Name                     string        `yaml:"name"`
+	Enabled                  bool          `yaml:"enabled"`
+	ApplicationScope         string        `yaml:"application_scope"`
+	ScanConfigFilter         string        `yaml:"scan_config_filter"`
+	AppQuery                 string        `yaml:"app_query"`
+	ScanQuery                string        `yaml:"scan_query"`
+	ScanStatuses             []string      `yaml:"scan_statuses"`
+	LastScanOnly             bool          `yaml:"last_scan_only"`
+	InitialImportMaxDays     int           `yaml:"initial_import_max_days"`
+	MapApplicationByName     bool          `yaml:"map_application_by_name"`
+	ThreadfixApplicationName string        `yaml:"threadfix_application_name"`
+	ThreadfixTeamName        string        `yaml:"threadfix_team_name"`
+	Upload                   UploadConf    `yaml:"upload"`
+	Redaction                RedactionConf `yaml:"redaction"`
+	Variances                string        `yaml:"variances"`
+	Metadata                 MetadataConf  `yaml:"metadata"`
+	Filters                  FilterConf    `yaml:"filters"`
+}
+
+// Findings exported by an export configuration; include lists export only matching findings when set, and exclude
+// lists never export matching findings
+type FilterConf struct {
+	// Lowest InsightAppSec severity exported, e.g. MEDIUM
+	MinSeverity string `yaml:"min_severity"`
+	// InsightAppSec vulnerability statuses exported, e.g. VERIFIED
+	Statuses []string `yaml:"statuses"`
+	// Regular expressions matched against the URL path of the vulnerability
+	IncludePaths []string `yaml:"include_paths"`
+	ExcludePaths []string `yaml:"exclude_paths"`
+	// InsightAppSec module IDs or names
+	IncludeModules []string `yaml:"include_modules"`
+	ExcludeModules []string `yaml:"exclude_modules"`
+	// CWE numbers, matched against every CWE of the finding
+	IncludeCWEs []string `yaml:"include_cwes"`
+	ExcludeCWEs []string `yaml:"exclude_cwes"`
+}
+
+// How scans are uploaded to Threadfix
+type UploadConf struct {
+	// single (default) or compress
+	Mode string `yaml:"mode"`
+}
+
+// Redaction of the attack requests and responses uploaded to Threadfix
+type RedactionConf struct {
+	// Headers whose values are redacted, e.g. Authorization or Cookie
+	Headers []string `yaml:"headers"`
+	// Regular expressions whose matches are redacted, e.g. tokens or personal information
+	Patterns []string `yaml:"patterns"`
+	// Longest body kept of each request and response; longer bodies are truncated when positive
+	MaxBodyLength int `yaml:"max_body_length"`
+	// Upload requests and responses unredacted instead of applying DefaultRedaction when nothing else is redacted
+	Disabled bool `yaml:"disabled"`
+}
+
+// Metadata recorded on the scans and findings uploaded to Threadfix, in addition to DefaultScanMetadata and
+// DefaultFindingMetadata
+type MetadataConf struct {
+	Scan    []MetadataTemplate `yaml:"scan"`
+	Finding []MetadataTemplate `yaml:"finding"`
+}
+
+// A metadata key and the template of its value, which replaces a default template of the same key; keys whose value
+// is empty are omitted
+type MetadataTemplate struct {
+	Key      string `yaml:"key"`
+	Template string `yaml:"template"`
 }
@@ -1,8 +1,13 @@
 package shared
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"github.com/go-resty/resty/v2"
+	"io/ioutil"
+	"net/url"
 	"strings"
 	"time"
 )
@@ -12,11 +17,63 @@ type APIConfiguration struct {
 	RestyClient *resty.Client
 }
 
-
 type APIClient struct {
 	Config APIConfiguration
 }
 
+// TLS and proxy settings for the connection to an API
+type TransportConfiguration struct {
+	// PEM file of certificate authorities trusted in addition to the system's
+	CABundle string
+	// PEM files of the client certificate and key presented for mutual TLS
+	ClientCertificate  string
+	ClientKey          string
+	InsecureSkipVerify bool
+	// HTTP(S) proxy URL; the HTTPS_PROXY, HTTP_PROXY, and NO_PROXY environment variables are used when not set
+	Proxy string
+}
+
+// Create a resty client using the TLS and proxy settings
+func NewRestyClient(transport TransportConfiguration) (*resty.Client, error) {
+	var tlsConfig = &tls.Config{InsecureSkipVerify: transport.InsecureSkipVerify}
+
+	if transport.CABundle != "" {
+		pem, err := ioutil.ReadFile(transport.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA bundle: %s", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", transport.CABundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if transport.ClientCertificate != "" || transport.ClientKey != "" {
+		if transport.ClientCertificate == "" || transport.ClientKey == "" {
+			return nil, errors.New("both a client certificate and client key are required for mutual TLS")
+		}
+		certificate, err := tls.LoadX509KeyPair(transport.ClientCertificate, transport.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	client := resty.New().SetTLSClientConfig(tlsConfig)
+	if transport.Proxy != "" {
+		// resty logs rather than returns invalid proxy URLs
+		if proxyUrl, err := url.Parse(transport.Proxy); err != nil || proxyUrl.Scheme == "" || proxyUrl.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %s", transport.Proxy)
+		}
+		client.SetProxy(transport.Proxy)
+	}
+	return client, nil
+}
+
 func (apiClient *APIClient) CallAPI(path string, method string,
 	postBody interface{},
 	headerParams map[string]string) (*resty.Response, error) {
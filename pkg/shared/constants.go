@@ -3,4 +3,9 @@ package shared
 // General constants
 const ApiMethodGet = "GET"
 const ApiMethodPost = "POST"
-const CWE = "CWE"
+
+// Secret reference prefixes
+const SecretEnvPrefix = "env:"
+const SecretFilePrefix = "file:"
+const SecretCommandPrefix = "cmd:"
+const SecretCommandTimeout = 30
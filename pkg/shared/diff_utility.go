@@ -0,0 +1,87 @@
+package shared
+
+import (
+	"strings"
+)
+
+// Lines of unchanged context shown around each change
+const DiffContextLines = 2
+
+// Describe the line differences between two texts, prefixing removed lines with "-", added lines with "+", and
+// surrounding context with a space. Returns an empty string when the texts are the same.
+func DiffLines(before string, after string) string {
+	beforeLines := splitLines(before)
+	afterLines := splitLines(after)
+
+	// Longest common subsequence of lines, from the end of both texts
+	common := make([][]int, len(beforeLines)+1)
+	for i := range common {
+		common[i] = make([]int, len(afterLines)+1)
+	}
+	for i := len(beforeLines) - 1; i >= 0; i-- {
+		for j := len(afterLines) - 1; j >= 0; j-- {
+			if beforeLines[i] == afterLines[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+
+	var lines []string
+	var changed []bool
+	i, j := 0, 0
+	for i < len(beforeLines) || j < len(afterLines) {
+		switch {
+		case i < len(beforeLines) && j < len(afterLines) && beforeLines[i] == afterLines[j]:
+			lines = append(lines, "  "+beforeLines[i])
+			changed = append(changed, false)
+			i++
+			j++
+		case i < len(beforeLines) && (j == len(afterLines) || common[i+1][j] >= common[i][j+1]):
+			lines = append(lines, "- "+beforeLines[i])
+			changed = append(changed, true)
+			i++
+		default:
+			lines = append(lines, "+ "+afterLines[j])
+			changed = append(changed, true)
+			j++
+		}
+	}
+
+	// Only show changes and their context
+	var output []string
+	var lastShown = -1
+	for index := range lines {
+		var show = false
+		for offset := -DiffContextLines; offset <= DiffContextLines; offset++ {
+			if index+offset >= 0 && index+offset < len(lines) && changed[index+offset] {
+				show = true
+				break
+			}
+		}
+		if !show {
+			continue
+		}
+		if lastShown >= 0 && index > lastShown+1 {
+			output = append(output, "...")
+		}
+		output = append(output, lines[index])
+		lastShown = index
+	}
+
+	if len(output) == 0 {
+		return ""
+	}
+	return strings.Join(output, "\n") + "\n"
+}
+
+func splitLines(text string) []string {
+	text = strings.TrimSuffix(strings.Replace(text, "\r\n", "\n", -1), "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
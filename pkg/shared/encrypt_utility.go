@@ -6,43 +6,144 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/shared/logging"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 )
 
 var ConfigFile string
 var filePath string
 
-func getKey() string {
+// Identifier of the original, unversioned key; values encrypted with it use the "(enc)" prefix rather than
+// "(enc:<id>)"
+const legacyKeyID = ""
+
+type encryptionKey struct {
+	ID    string
+	Value string
+}
+
+type DecryptErrorKind int
+
+const (
+	// No key with the id the value was encrypted with is available
+	DecryptMissingKey DecryptErrorKind = iota
+	// The value was encrypted with a different key than the one available for its id
+	DecryptWrongKey
+	// The value is not a valid encrypted value
+	DecryptCorruptedValue
+)
+
+// Why an encrypted value could not be decrypted
+type DecryptError struct {
+	Kind  DecryptErrorKind
+	KeyID string
+	Err   error
+}
+
+func (decryptError *DecryptError) Error() string {
+	var key = "the original encryption key"
+	if decryptError.KeyID != legacyKeyID {
+		key = fmt.Sprintf("encryption key %s", decryptError.KeyID)
+	}
+
+	switch decryptError.Kind {
+	case DecryptMissingKey:
+		return fmt.Sprintf("%s is not available; provide it in the .enc.key file next to the configuration "+
+			"file or the R7_ENCRYPTION_KEY environment variable", key)
+	case DecryptWrongKey:
+		return fmt.Sprintf("value was not encrypted with the available %s, or has been modified; verify the "+
+			".enc.key file or R7_ENCRYPTION_KEY environment variable is the key the value was encrypted with", key)
+	}
+	return fmt.Sprintf("encrypted value is corrupted: %s; re-enter the value to encrypt it again", decryptError.Err)
+}
+
+// Keys are read from the .enc.key file next to the configuration file, one per line as "<id>:<key>", where a line
+// without an id is the original unversioned key. Once keys are rotated the original key is written as
+// ":<base64 of the key>", since its bytes, such as a trailing newline, must be kept exactly to decrypt its values. A key provided by the R7_ENCRYPTION_KEY environment variable, with
+// an optional id from R7_ENCRYPTION_KEY_ID, is added to the keys in the file. The last key is used for encryption.
+func getKeys() []encryptionKey {
+	keys, err := loadKeys()
+	if err != nil {
+		logging.Logger.Info("No encryption key found in file or as environment variable")
+		generateKey()
+
+		return getKeys()
+	}
+	return keys
+}
+
+func loadKeys() ([]encryptionKey, error) {
 	dir, _ := filepath.Split(ConfigFile)
 	filePath = dir + ".enc.key"
 
-	value, exists := os.LookupEnv("R7_ENCRYPTION_KEY")
-	if !exists {
-		fileBytes, err := ioutil.ReadFile(filePath)
+	var keys []encryptionKey
+	fileBytes, err := ioutil.ReadFile(filePath)
+	if err == nil {
+		keys = parseKeys(string(fileBytes))
+	}
+
+	if value, exists := os.LookupEnv("R7_ENCRYPTION_KEY"); exists {
+		keys = append(keys, encryptionKey{ID: os.Getenv("R7_ENCRYPTION_KEY_ID"), Value: value})
+	} else if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
 
-		if err != nil {
-			logging.Logger.Info("No encryption key found in file or as environment variable")
-			generateKey()
+func parseKeys(value string) []encryptionKey {
+	// Original key files hold a single unversioned key
+	if !strings.Contains(value, ":") {
+		return []encryptionKey{{ID: legacyKeyID, Value: value}}
+	}
 
-			return getKey()
+	var keys []encryptionKey
+	for _, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if parts := strings.SplitN(line, ":", 2); len(parts) == 2 && parts[0] == legacyKeyID {
+			original, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				logging.Logger.Errorf("Ignoring invalid original encryption key in %s: %s", filePath, err)
+				continue
+			}
+			keys = append(keys, encryptionKey{ID: legacyKeyID, Value: string(original)})
+		} else if len(parts) == 2 {
+			keys = append(keys, encryptionKey{ID: parts[0], Value: parts[1]})
+		} else {
+			keys = append(keys, encryptionKey{ID: legacyKeyID, Value: line})
 		}
+	}
+	return keys
+}
 
-		value = string(fileBytes)
+func getKey() encryptionKey {
+	keys := getKeys()
+	return keys[len(keys)-1]
+}
+
+// Find a key by id without generating a key when none exists; a new key could never decrypt existing values. Later
+// keys take precedence, so the R7_ENCRYPTION_KEY environment variable overrides a key file key with the same id.
+func findKey(id string) (encryptionKey, bool) {
+	keys, _ := loadKeys()
+	for index := len(keys) - 1; index >= 0; index-- {
+		if keys[index].ID == id {
+			return keys[index], true
+		}
 	}
-	return value
+	return encryptionKey{}, false
 }
 
 func generateKey() {
-	key := make([]byte, 64)
-	rand.Read(key)
-
-	err := ioutil.WriteFile(filePath, []byte(base64.RawURLEncoding.EncodeToString(key)), 0400)
+	err := ioutil.WriteFile(filePath, []byte(newKeyValue()), 0400)
 	if err != nil {
 		logging.Logger.Fatal(fmt.Sprintf("Failed to generate ecnryption key; unable to continue: %s", err))
 	} else {
@@ -50,13 +151,117 @@ func generateKey() {
 	}
 }
 
+func newKeyValue() string {
+	key := make([]byte, 64)
+	rand.Read(key)
+	return base64.RawURLEncoding.EncodeToString(key)
+}
+
+// Generate a new key in the key file and use it for encryption from now on. Existing keys are kept so values
+// encrypted with them still decrypt while they are rolled out.
+func RotateKey() (string, error) {
+	if _, exists := os.LookupEnv("R7_ENCRYPTION_KEY"); exists {
+		return "", errors.New("the encryption key is provided by the R7_ENCRYPTION_KEY environment variable; " +
+			"unset it to rotate the key in the key file, or provide a new key and R7_ENCRYPTION_KEY_ID instead")
+	}
+
+	keys := getKeys()
+	var latest = 1
+	for _, key := range keys {
+		if version, err := strconv.Atoi(strings.TrimPrefix(key.ID, "v")); err == nil && version > latest {
+			latest = version
+		}
+	}
+	id := fmt.Sprintf("v%d", latest+1)
+
+	keys = append(keys, encryptionKey{ID: id, Value: newKeyValue()})
+	if err := writeKeys(keys); err != nil {
+		return "", err
+	}
+	logging.Logger.Infof("Encryption key %s created and saved in %s", id, filePath)
+	return id, nil
+}
+
+// Remove keys from the key file that are not the active key and are not used by any of the given key ids
+func PruneKeys(usedKeyIds []string) ([]string, error) {
+	if _, exists := os.LookupEnv("R7_ENCRYPTION_KEY"); exists {
+		return nil, errors.New("the encryption key is provided by the R7_ENCRYPTION_KEY environment variable; " +
+			"unset it to prune keys from the key file")
+	}
+
+	keys := getKeys()
+	used := map[string]bool{keys[len(keys)-1].ID: true}
+	for _, id := range usedKeyIds {
+		used[id] = true
+	}
+
+	var kept []encryptionKey
+	var removed []string
+	for _, key := range keys {
+		if used[key.ID] {
+			kept = append(kept, key)
+		} else {
+			removed = append(removed, key.ID)
+		}
+	}
+
+	if len(removed) == 0 {
+		return removed, nil
+	}
+	return removed, writeKeys(kept)
+}
+
+func writeKeys(keys []encryptionKey) error {
+	// A file with only the unversioned key must keep its original format, byte for byte
+	if len(keys) == 1 && keys[0].ID == legacyKeyID {
+		return WriteFileAtomic(filePath, []byte(keys[0].Value), 0400, 0)
+	}
+
+	var lines []string
+	for _, key := range keys {
+		if key.ID == legacyKeyID {
+			lines = append(lines, ":"+base64.StdEncoding.EncodeToString([]byte(key.Value)))
+		} else {
+			lines = append(lines, key.ID+":"+key.Value)
+		}
+	}
+	content := strings.Join(lines, "\n") + "\n"
+	// No backup is kept; a copy of the previous file would keep pruned keys on disk
+	return WriteFileAtomic(filePath, []byte(content), 0400, 0)
+}
+
 func createHash(key string) string {
 	hash := sha256.Sum256([]byte(key))
 	return string(hash[:])
 }
 
+// Whether a value is encrypted, with either the "(enc)" or versioned "(enc:<id>)" prefix
+func IsEncrypted(value string) bool {
+	_, _, encrypted := parseEncrypted(value)
+	return encrypted
+}
+
+// Identifier of the key an encrypted value was encrypted with
+func EncryptionKeyID(value string) string {
+	id, _, _ := parseEncrypted(value)
+	return id
+}
+
+func parseEncrypted(value string) (string, string, bool) {
+	if strings.HasPrefix(value, "(enc)") {
+		return legacyKeyID, strings.TrimPrefix(value, "(enc)"), true
+	}
+	if strings.HasPrefix(value, "(enc:") {
+		if end := strings.Index(value, ")"); end > len("(enc:") {
+			return value[len("(enc:"):end], value[end+1:], true
+		}
+	}
+	return "", value, false
+}
+
 func Encrypt(value string) string {
-	block, _ := aes.NewCipher([]byte(createHash(getKey())))
+	key := getKey()
+	block, _ := aes.NewCipher([]byte(createHash(key.Value)))
 	gcm, err := cipher.NewGCM(block)
 	if err != nil {
 		panic(err.Error())
@@ -66,43 +271,51 @@ func Encrypt(value string) string {
 		panic(err.Error())
 	}
 	ciphertext := gcm.Seal(nonce, nonce, []byte(value), nil)
-	return fmt.Sprintf("(enc)%s", encodeBase64(ciphertext))
+	if key.ID == legacyKeyID {
+		return fmt.Sprintf("(enc)%s", encodeBase64(ciphertext))
+	}
+	return fmt.Sprintf("(enc:%s)%s", key.ID, encodeBase64(ciphertext))
 }
 
-func Decrypt(value string) string {
-	var data []byte
-	if strings.HasPrefix(value, "(enc)") {
-		value = strings.TrimPrefix(value, "(enc)")
-		data = decodeBase64(value)
-	} else {
-		return value
+// Decrypt a value encrypted with Encrypt; values without an encryption prefix are returned as is
+func Decrypt(value string) (string, error) {
+	id, encoded, encrypted := parseEncrypted(value)
+	if !encrypted {
+		return value, nil
 	}
 
-	key := []byte(createHash(getKey()))
-	block, err := aes.NewCipher(key)
+	encryptionKey, found := findKey(id)
+	if !found {
+		return "", &DecryptError{Kind: DecryptMissingKey, KeyID: id}
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
 	if err != nil {
-		panic(err.Error())
+		return "", &DecryptError{Kind: DecryptCorruptedValue, KeyID: id, Err: err}
+	}
+
+	block, err := aes.NewCipher([]byte(createHash(encryptionKey.Value)))
+	if err != nil {
+		return "", &DecryptError{Kind: DecryptWrongKey, KeyID: id, Err: err}
 	}
 	gcm, err := cipher.NewGCM(block)
 	if err != nil {
-		panic(err.Error())
+		return "", &DecryptError{Kind: DecryptWrongKey, KeyID: id, Err: err}
 	}
 	nonceSize := gcm.NonceSize()
+	if len(data) < nonceSize+gcm.Overhead() {
+		return "", &DecryptError{Kind: DecryptCorruptedValue, KeyID: id,
+			Err: errors.New("encrypted value is too short")}
+	}
 	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
 	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
 	if err != nil {
-		logging.Logger.Error(fmt.Sprintf("Failed to decrypt, setting to empty string: %s", err))
-		return ""
+		// GCM cannot tell a different key from a modified value; a well-formed value is most likely the wrong key
+		return "", &DecryptError{Kind: DecryptWrongKey, KeyID: id, Err: err}
 	}
-	return string(plaintext)
+	return string(plaintext), nil
 }
 
 func encodeBase64(b []byte) string {
 	return base64.StdEncoding.EncodeToString(b)
 }
-
-func decodeBase64(s string) []byte {
-	data, err := base64.StdEncoding.DecodeString(s)
-	if err != nil { panic(err) }
-	return data
-}
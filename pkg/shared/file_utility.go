@@ -0,0 +1,80 @@
+package shared
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Write a file by writing and syncing a temporary file in the same directory and renaming it over the original, so
+// the file is never left partially written. The previous contents are kept in up to the given number of timestamped
+// backups, removing the oldest first.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode, backups int) error {
+	dir, filename := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+
+	// Keep the permissions of an existing file
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	temp, err := ioutil.TempFile(dir, "."+filename+".tmp")
+	if err != nil {
+		return fmt.Errorf("unable to create temporary file: %s", err)
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return fmt.Errorf("unable to write temporary file: %s", err)
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return fmt.Errorf("unable to sync temporary file: %s", err)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("unable to write temporary file: %s", err)
+	}
+	if err := os.Chmod(temp.Name(), perm); err != nil {
+		return fmt.Errorf("unable to set permissions of temporary file: %s", err)
+	}
+
+	if backups > 0 {
+		if err := backupFile(path, backups); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return fmt.Errorf("unable to replace %s: %s", path, err)
+	}
+	return nil
+}
+
+// Copy a file to a timestamped backup and remove the oldest backups beyond the number to keep
+func backupFile(path string, keep int) error {
+	original, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("unable to read %s for backup: %s", path, err)
+	}
+
+	backupPath := fmt.Sprintf("%s.%s.bak", path, time.Now().UTC().Format("20060102T150405.000000000Z"))
+	if err := ioutil.WriteFile(backupPath, original, 0600); err != nil {
+		return fmt.Errorf("unable to write backup %s: %s", backupPath, err)
+	}
+
+	existingBackups, _ := filepath.Glob(path + ".*.bak")
+	sort.Strings(existingBackups)
+	for len(existingBackups) > keep {
+		os.Remove(existingBackups[0])
+		existingBackups = existingBackups[1:]
+	}
+	return nil
+}
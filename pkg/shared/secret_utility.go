@@ -0,0 +1,81 @@
+package shared
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Whether a value refers to a secret stored outside the configuration file
+func IsSecretReference(value string) bool {
+	return strings.HasPrefix(value, SecretEnvPrefix) ||
+		strings.HasPrefix(value, SecretFilePrefix) ||
+		strings.HasPrefix(value, SecretCommandPrefix)
+}
+
+// Resolve a secret from its configured value, which is one of:
+//
+//	env:NAME       the value of the NAME environment variable
+//	file:PATH      the contents of a file, such as a mounted Kubernetes secret
+//	cmd:COMMAND    the standard output of a command run by the system shell
+//	(enc)...       a value encrypted with a local encryption key, also (enc:<key id>)...
+//
+// Any other value is used as is.
+func ResolveSecret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, SecretEnvPrefix):
+		name := strings.TrimPrefix(value, SecretEnvPrefix)
+		secret, exists := os.LookupEnv(name)
+		if !exists || secret == "" {
+			return "", errors.New(fmt.Sprintf("environment variable %s is not set", name))
+		}
+		return secret, nil
+	case strings.HasPrefix(value, SecretFilePrefix):
+		path := strings.TrimPrefix(value, SecretFilePrefix)
+		secret, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", errors.New(fmt.Sprintf("unable to read secret file: %s", err))
+		}
+		return strings.TrimSpace(string(secret)), nil
+	case strings.HasPrefix(value, SecretCommandPrefix):
+		return runSecretCommand(strings.TrimPrefix(value, SecretCommandPrefix))
+	case IsEncrypted(value):
+		return Decrypt(value)
+	}
+	return value, nil
+}
+
+func runSecretCommand(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), SecretCommandTimeout*time.Second)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", errors.New(fmt.Sprintf("secret command timed out after %d seconds", SecretCommandTimeout))
+	}
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("secret command failed: %s: %s", err, strings.TrimSpace(stderr.String())))
+	}
+
+	secret := strings.TrimSpace(string(output))
+	if secret == "" {
+		return "", errors.New("secret command produced no output")
+	}
+	return secret, nil
+}
@@ -0,0 +1,159 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/insightappsec"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/integration"
+)
+
+func TestBackfill(t *testing.T) {
+	directory, err := ioutil.TempDir("", "checkpoints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	integration.CheckpointDirectory = directory
+
+	mux := insightAppSecStandInMux()
+	mux.HandleFunc("/us/ias/v1/search", func(w http.ResponseWriter, r *http.Request) {
+		var search insightappsec.SearchParameters
+		json.NewDecoder(r.Body).Decode(&search)
+		switch search.Type {
+		case insightappsec.AppSearchType:
+			fmt.Fprint(w, `{"data": [{"id": "1550c422-2273-4f27-9674-31fc814f3558", "name": "Hackazon"}],
+				"metadata": {"total_data": 1}}`)
+		case insightappsec.ScanSearchType:
+			// The first scan completed when the Threadfix stand in's InsightAppSec scan was updated, the second when
+			// its OWASP ZAP scan was
+			fmt.Fprint(w, `{"data": [
+				{"id": "imported", "status": "COMPLETE", "completion_time": "2019-10-16T15:00:00.000"},
+				{"id": "missing", "status": "COMPLETE", "completion_time": "2019-10-17T15:00:00.000"}],
+				"metadata": {"total_data": 2}}`)
+		default:
+			fmt.Fprint(w, `{"data": [{"id": "vuln-1", "severity": "HIGH"}], "metadata": {"total_data": 1}}`)
+		}
+	})
+	ias := httptest.NewServer(mux)
+	defer ias.Close()
+
+	tf := threadfixStandIn("mixed")
+	defer tf.Close()
+
+	defer useStandIns(ias.URL, tf.URL)()
+
+	exportConfigurations := []integration.ExportConfiguration{
+		{Name: "Hackazon Import", ApplicationScope: "Hackazon", ThreadfixTeamName: "AppSec",
+			ThreadfixApplicationName: "Hackazon"},
+		{Name: "Missing Import", ApplicationScope: "Hackazon", ThreadfixTeamName: "AppSec",
+			ThreadfixApplicationName: "Missing"},
+	}
+	from := time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2019, 10, 31, 0, 0, 0, 0, time.UTC)
+	numScans, err := integration.Backfill(exportConfigurations, "", from, to)
+
+	// Only the scan matching an InsightAppSec scan in Threadfix is skipped
+	if numScans != 1 {
+		t.Errorf("Expected 1 scan to be backfilled, got %d", numScans)
+	}
+	// The application that failed is reported once the others have been backfilled
+	if err == nil || !strings.Contains(err.Error(), "[Missing Import] Missing") {
+		t.Errorf("Expected the missing Threadfix application to be reported, got %v", err)
+	}
+}
+
+func TestBackfillResumesAndMatchesScanIds(t *testing.T) {
+	directory, err := ioutil.TempDir("", "checkpoints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	integration.CheckpointDirectory = directory
+
+	mux := insightAppSecStandInMux()
+	mux.HandleFunc("/us/ias/v1/scans/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": "leftover", "status": "COMPLETE", "completion_time": "2019-10-02T15:00:00.000"}`)
+	})
+	mux.HandleFunc("/us/ias/v1/search", func(w http.ResponseWriter, r *http.Request) {
+		var search insightappsec.SearchParameters
+		json.NewDecoder(r.Body).Decode(&search)
+		switch search.Type {
+		case insightappsec.AppSearchType:
+			fmt.Fprint(w, `{"data": [{"id": "1550c422-2273-4f27-9674-31fc814f3558", "name": "Hackazon"}],
+				"metadata": {"total_data": 1}}`)
+		case insightappsec.ScanSearchType:
+			fmt.Fprint(w, `{"data": [
+				{"id": "imported", "status": "COMPLETE", "completion_time": "2019-10-16T15:00:00.000"},
+				{"id": "same-second", "status": "COMPLETE", "completion_time": "2019-10-17T15:00:00.000"}],
+				"metadata": {"total_data": 2}}`)
+		default:
+			fmt.Fprint(w, `{"data": [{"id": "vuln-1", "severity": "HIGH"}], "metadata": {"total_data": 1}}`)
+		}
+	})
+	ias := httptest.NewServer(mux)
+	defer ias.Close()
+
+	// Threadfix holds the "imported" scan under a different updated date, and another InsightAppSec scan completed
+	// in the same second as "same-second"
+	var uploaded []string
+	tf := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rest/applications/AppSec/lookup":
+			body, _ := ioutil.ReadFile(filepath.Join("fixtures", "threadfix", "mixed", "lookup.json"))
+			w.Write(body)
+		case "/rest/applications/7/scans":
+			fmt.Fprint(w, `{"success": true, "object": [
+				{"id": 11, "updatedDate": 1571500800000, "scannerName": "Rapid7 InsightAppSec",
+					"originalFileNames": ["InsightAppSec-ScanID-imported.threadfix"]},
+				{"id": 12, "updatedDate": 1571324400000, "scannerName": "Rapid7 InsightAppSec",
+					"originalFileNames": ["InsightAppSec-ScanID-rescanned.threadfix"]}]}`)
+		case "/rest/v2.5/applications/7/upload":
+			_, header, err := r.FormFile("file")
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			uploaded = append(uploaded, header.Filename)
+			fmt.Fprint(w, `{"success": true, "object": "Scan uploaded"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer tf.Close()
+
+	defer useStandIns(ias.URL, tf.URL)()
+
+	// An earlier backfill was interrupted before uploading "leftover"
+	checkpoint, err := integration.LoadBackfillCheckpoint("Hackazon Import", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkpoint.Start([]string{"leftover"})
+
+	exportConfigurations := []integration.ExportConfiguration{{Name: "Hackazon Import", ApplicationScope: "Hackazon",
+		ThreadfixTeamName: "AppSec", ThreadfixApplicationName: "Hackazon"}}
+	from := time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2019, 10, 31, 0, 0, 0, 0, time.UTC)
+	numScans, err := integration.Backfill(exportConfigurations, "", from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The checkpointed scan is resumed first, and only the scan whose ID Threadfix already holds is skipped
+	expected := []string{"InsightAppSec-ScanID-leftover.threadfix", "InsightAppSec-ScanID-same-second.threadfix"}
+	if numScans != 2 || fmt.Sprint(uploaded) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v to be backfilled, got %d scan(s): %v", expected, numScans, uploaded)
+	}
+	if files, _ := ioutil.ReadDir(directory); len(files) != 0 {
+		t.Error("Expected the backfill checkpoint to be removed once all scans were imported")
+	}
+}
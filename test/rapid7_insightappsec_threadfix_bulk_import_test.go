@@ -0,0 +1,59 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/integration"
+)
+
+func TestParseScanImportRequests(t *testing.T) {
+	csvInput := `scan_id,team,app
+# Scans for the nightly run
+3113af46-29cb-4f93-92e5-eddfbac4ed2c
+5b00b027-9a3d-402a-8f12-86bb761a19e6, Hackazon, "Hackazon, Staging"
+`
+	requests, err := integration.ParseScanImportRequests(strings.NewReader(csvInput), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 2 || requests[0].Team != "" || requests[1].App != "Hackazon, Staging" {
+		t.Errorf("Unexpected requests parsed from CSV: %+v", requests)
+	}
+
+	jsonInput := `[{"scan_id": "3113af46-29cb-4f93-92e5-eddfbac4ed2c", "team": "Hackazon", "app": "Hackazon"}]`
+	requests, err = integration.ParseScanImportRequests(strings.NewReader(jsonInput), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 1 || requests[0].ScanID != "3113af46-29cb-4f93-92e5-eddfbac4ed2c" {
+		t.Errorf("Unexpected requests parsed from JSON: %+v", requests)
+	}
+
+	results := integration.BulkImportScans([]integration.ScanImportRequest{{ScanID: "missing-team"}}, "", "",
+		integration.ExportConfiguration{})
+	if len(results) != 1 || results[0].Error == nil {
+		t.Error("Expected a failed result for a scan without a Threadfix team and application")
+	}
+}
+
+func TestScanImportConfiguration(t *testing.T) {
+	exportConfigurations := []integration.ExportConfiguration{{Name: "Hackazon Import",
+		Redaction: integration.RedactionConf{Patterns: []string{`token=(\w+)`}}}}
+
+	// Scans imported without an export configuration never upload credential headers
+	exportConfiguration, err := integration.ScanImportConfiguration(exportConfigurations, "")
+	redactor, _ := integration.NewRedactor(integration.EffectiveRedaction(exportConfiguration.Redaction))
+	if redacted := redactor.Redact("GET / HTTP/1.1\r\nAuthorization: Bearer secret\r\n\r\n"); err != nil ||
+		strings.Contains(redacted, "secret") {
+		t.Errorf("Expected the default redaction to redact the Authorization header, got %q (%v)", redacted, err)
+	}
+
+	exportConfiguration, err = integration.ScanImportConfiguration(exportConfigurations, "Hackazon Import")
+	if err != nil || len(exportConfiguration.Redaction.Patterns) != 1 {
+		t.Errorf("Expected the named export configuration, got %+v (%v)", exportConfiguration, err)
+	}
+	if _, err := integration.ScanImportConfiguration(exportConfigurations, "Missing"); err == nil {
+		t.Error("Expected an unknown export configuration to be reported")
+	}
+}
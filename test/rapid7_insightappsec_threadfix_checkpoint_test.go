@@ -0,0 +1,85 @@
+package test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/threadfix"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/integration"
+)
+
+func TestCheckpointResume(t *testing.T) {
+	directory, err := ioutil.TempDir("", "checkpoints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	integration.CheckpointDirectory = directory
+
+	checkpoint, err := integration.LoadCheckpoint("Backfill / Hackazon", 12)
+	if err != nil || checkpoint.Pending() {
+		t.Fatalf("Expected no pending checkpoint, got %v (%v)", checkpoint, err)
+	}
+
+	checkpoint.Start([]string{"scan-1", "scan-2", "scan-3"})
+	checkpoint.Complete("scan-1", true)
+
+	// A later run picks up where the previous one stopped
+	resumed, err := integration.LoadCheckpoint("Backfill / Hackazon", 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resumed.RemainingScans) != 2 || resumed.RemainingScans[0] != "scan-2" || resumed.LastUploadedScan != "scan-1" {
+		t.Errorf("Unexpected checkpoint after resume: %+v", resumed)
+	}
+
+	resumed.Complete("scan-2", true)
+	resumed.Complete("scan-3", true)
+	if files, _ := ioutil.ReadDir(directory); len(files) != 0 {
+		t.Error("Expected checkpoint to be removed once all scans were imported")
+	}
+}
+
+func TestResumeMissingScans(t *testing.T) {
+	directory, err := ioutil.TempDir("", "checkpoints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	integration.CheckpointDirectory = directory
+
+	var status = http.StatusInternalServerError
+	ias := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer ias.Close()
+	defer useStandIns(ias.URL, "")()
+
+	checkpoint, err := integration.LoadCheckpoint("Hackazon Import", 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkpoint.Start([]string{"scan-1"})
+
+	// A failure to retrieve the scan keeps it in the checkpoint
+	_, err = integration.ResumeScans(threadfix.Application{}, checkpoint, integration.ExportConfiguration{})
+	if err == nil {
+		t.Error("Expected resuming to fail when InsightAppSec fails")
+	}
+	if !checkpoint.Pending() {
+		t.Error("Expected the scan to remain in the checkpoint after a failed request")
+	}
+
+	// Only a scan that no longer exists is dropped
+	status = http.StatusNotFound
+	_, err = integration.ResumeScans(threadfix.Application{}, checkpoint, integration.ExportConfiguration{})
+	if err != nil {
+		t.Error(err)
+	}
+	if checkpoint.Pending() {
+		t.Errorf("Expected the missing scan to be dropped from the checkpoint, got %v", checkpoint.RemainingScans)
+	}
+}
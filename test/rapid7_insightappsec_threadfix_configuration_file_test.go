@@ -0,0 +1,100 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/integration"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/shared"
+	"github.com/spf13/viper"
+)
+
+const legacyConfiguration = `connections:
+  threadfix:
+    host: https://threadfix.example.com
+    port: "8443"
+exportconfigurations:
+- name: Hackazon Import
+  applicationscope: Hackazon
+  threadfixteamname: Hackazon
+severitymappings:
+- InsightAppSec: SAFE
+  Threadfix: Info
+internalscheduler: '*/5 * * * *'
+`
+
+func TestSaveConfiguration(t *testing.T) {
+	directory, err := ioutil.TempDir("", "configuration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	configFile := filepath.Join(directory, "settings.yml")
+	if err := ioutil.WriteFile(configFile, []byte(legacyConfiguration), 0600); err != nil {
+		t.Fatal(err)
+	}
+	viper.SetConfigFile(configFile)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Configuration files from earlier versions load under the canonical keys
+	settings := &integration.SettingsConf{}
+	if err := integration.UnmarshalConfiguration(settings); err != nil {
+		t.Fatal(err)
+	}
+	if len(settings.ExportConfigurations) != 1 || settings.ExportConfigurations[0].ApplicationScope != "Hackazon" ||
+		settings.ExportConfigurations[0].ThreadfixTeamName != "Hackazon" || settings.SeverityMappings[0].Threadfix != "Info" {
+		t.Fatalf("Unexpected configuration loaded from legacy keys: %+v", settings)
+	}
+
+	settings.Connections.Threadfix.Port = "9443"
+	diff, err := integration.ConfigurationDiff(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(diff, `-     port: "8443"`) || !strings.Contains(diff, `+     port: "9443"`) ||
+		!strings.Contains(diff, "+   application_scope: Hackazon") {
+		t.Errorf("Unexpected configuration diff:\n%s", diff)
+	}
+
+	if err := integration.SaveConfiguration(settings); err != nil {
+		t.Fatal(err)
+	}
+	saved, _ := ioutil.ReadFile(configFile)
+	if !strings.Contains(string(saved), "exportConfigurations:") || strings.Contains(string(saved), "applicationscope") {
+		t.Errorf("Expected configuration saved with canonical keys:\n%s", saved)
+	}
+	if backups, _ := filepath.Glob(configFile + ".*.bak"); len(backups) != 1 {
+		t.Errorf("Expected a backup of the previous configuration, got %v", backups)
+	}
+
+	// Saved configuration loads back unchanged
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := &integration.SettingsConf{}
+	if err := integration.UnmarshalConfiguration(reloaded); err != nil {
+		t.Fatal(err)
+	}
+	if diff, _ := integration.ConfigurationDiff(reloaded); diff != "" {
+		t.Errorf("Expected no changes after reloading the saved configuration, got:\n%s", diff)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	if diff := shared.DiffLines("a\nb\n", "a\nb\n"); diff != "" {
+		t.Errorf("Expected no differences, got %q", diff)
+	}
+
+	before := "1\n2\n3\n4\n5\n6\n7\n8\n9\n"
+	after := "1\n2\nthree\n4\n5\n6\n7\n8\n9\nten\n"
+	expected := "  1\n  2\n- 3\n+ three\n  4\n  5\n...\n  8\n  9\n+ ten\n"
+	if diff := shared.DiffLines(before, after); diff != expected {
+		t.Errorf("Expected diff:\n%s\ngot:\n%s", expected, diff)
+	}
+}
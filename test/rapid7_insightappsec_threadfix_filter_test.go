@@ -0,0 +1,105 @@
+package test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/insightappsec"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/threadfix"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/integration"
+)
+
+func TestFilterByDateRange(t *testing.T) {
+	scans := []insightappsec.Scan{
+		{ID: "newest", CompletionTime: "2019-08-20T10:00:00.123"},
+		{ID: "middle", CompletionTime: "2019-08-10T10:00:00.456"},
+		{ID: "oldest", CompletionTime: "2019-08-01T10:00:00.789"},
+		{ID: "before", CompletionTime: "2019-07-01T10:00:00.000"},
+	}
+	from := time.Date(2019, 8, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2019, 8, 21, 0, 0, 0, 0, time.UTC)
+
+	filteredScans := integration.FilterByDateRange(scans, from, to)
+	integration.SortByCompletionTime(filteredScans)
+
+	if len(filteredScans) != 3 {
+		t.Fatalf("Expected 3 scans in range, got %d", len(filteredScans))
+	}
+	for index, id := range []string{"oldest", "middle", "newest"} {
+		if filteredScans[index].ID != id {
+			t.Errorf("Expected scan %s at position %d, got %s", id, index, filteredScans[index].ID)
+		}
+	}
+}
+
+func TestFindingFilters(t *testing.T) {
+	// Every module of the stand in is SQL Injection with CWE-89
+	mux := insightAppSecStandInMux()
+	mux.HandleFunc("/us/ias/v1/search", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data": [
+			{"id": "low", "severity": "LOW", "status": "VERIFIED", "root_cause": {"url": "http://hackazon.webscantest.com/search"}},
+			{"id": "high", "severity": "HIGH", "status": "VERIFIED", "root_cause": {"url": "http://hackazon.webscantest.com/search?id=1"}},
+			{"id": "ignored", "severity": "HIGH", "status": "IGNORED", "root_cause": {"url": "http://hackazon.webscantest.com/search"}},
+			{"id": "static", "severity": "HIGH", "status": "VERIFIED", "root_cause": {"url": "http://hackazon.webscantest.com/static/app.js"}}
+		], "metadata": {"total_data": 4}}`)
+	})
+	ias := httptest.NewServer(mux)
+	defer ias.Close()
+
+	var received []threadfix.ThreadfixScan
+	var receivedErr error
+	tf := threadfixUploadStandIn(&received, &receivedErr)
+	defer tf.Close()
+
+	defer useStandIns(ias.URL, tf.URL)()
+	integration.ResetFilteredFindings()
+
+	for _, test := range []struct {
+		filters  integration.FilterConf
+		expected []string
+	}{
+		{filters: integration.FilterConf{}, expected: []string{"high", "ignored", "low", "static"}},
+		{filters: integration.FilterConf{MinSeverity: "medium"}, expected: []string{"high", "ignored", "static"}},
+		{filters: integration.FilterConf{Statuses: []string{"UNREVIEWED", "verified"}},
+			expected: []string{"high", "low", "static"}},
+		{filters: integration.FilterConf{ExcludePaths: []string{`^/static/`}},
+			expected: []string{"high", "ignored", "low"}},
+		{filters: integration.FilterConf{IncludePaths: []string{`^/static/`}}, expected: []string{"static"}},
+		{filters: integration.FilterConf{IncludeModules: []string{"sql injection"}},
+			expected: []string{"high", "ignored", "low", "static"}},
+		{filters: integration.FilterConf{ExcludeModules: []string{"b6f559d3-74b5-451e-b424-a1c1fb264fa6"}}},
+		{filters: integration.FilterConf{IncludeCWEs: []string{"CWE-79"}}},
+		{filters: integration.FilterConf{ExcludeCWEs: []string{"79"}, MinSeverity: "HIGH",
+			ExcludePaths: []string{`\.js$`}}, expected: []string{"high", "ignored"}},
+	} {
+		received = nil
+		scan := insightappsec.Scan{ID: "3113af46-29cb-4f93-92e5-eddfbac4ed2c", Status: "COMPLETE"}
+		// A scan whose findings are all filtered is uploaded empty, so Threadfix closes the filtered vulnerabilities
+		if !integration.UploadScan(threadfix.Application{}, scan,
+			integration.ExportConfiguration{Name: "Hackazon Import", Filters: test.filters}) {
+			t.Fatalf("%+v: expected scan to be uploaded: %v", test.filters, receivedErr)
+		}
+
+		var nativeIds []string
+		for _, finding := range received[0].Findings {
+			nativeIds = append(nativeIds, finding.NativeID)
+		}
+		sort.Strings(nativeIds)
+		if len(nativeIds) != len(test.expected) || len(nativeIds) > 0 && !reflect.DeepEqual(nativeIds, test.expected) {
+			t.Errorf("%+v: expected findings %v, got %v", test.filters, test.expected, nativeIds)
+		}
+	}
+
+	// The findings filtered from uploaded scans are counted for the export configuration across the run
+	expected := map[string]map[string]int{"Hackazon Import": {integration.FilteredBySeverity: 2,
+		integration.FilteredByStatus: 1, integration.FilteredByPath: 5, integration.FilteredByModule: 4,
+		integration.FilteredByCWE: 4}}
+	if filtered := integration.FilteredFindings(); !reflect.DeepEqual(filtered, expected) {
+		t.Errorf("Expected filtered findings %v, got %v", expected, filtered)
+	}
+}
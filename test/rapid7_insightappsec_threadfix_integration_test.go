@@ -7,17 +7,26 @@ import (
 	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/insightappsec"
 	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/integration"
 	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/shared"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/shared/logging"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/shared/metrics"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 )
 
 func init() {
+	// Set up logging and metrics that are usually initialized from configuration
+	logging.Setup(os.TempDir(), "rapid7-insightappsec-threadfix-test.log", "info", false)
+	metrics.Setup(os.TempDir(), "rapid7-insightappsec-threadfix-test-metrics.log", false)
+
 	var iasClient insightappsec.API
 
 	var config = insightappsec.InsightAppSecConfiguration{
 		Region:   "us",
-		APIKey:   os.Getenv("INSIGHTAPPSEC_API_KEY"),
-		BasePath: "https://%s.api.insight.rapid7.com/ias/v1/"}
+		APIKey:   "insightappsec-test-key",
+		BasePath: insightAppSecStandIn().URL + "/{region}/ias/v1/"}
 
 	var apiConfig = shared.APIConfiguration{Timeout: 30, RestyClient: resty.New()}
 	var apiClient = shared.APIClient{Config: apiConfig}
@@ -29,11 +38,11 @@ func init() {
 
 	// Set up Severity Mapping
 	var severityMappings = []integration.SeverityMapping{
-		{Threadfix: "SAFE", InsightAppSec: "Info",},
-		{Threadfix: "INFORMATIONAL", InsightAppSec: "Low",},
-		{Threadfix: "LOW", InsightAppSec: "Medium",},
-		{Threadfix: "MEDIUM", InsightAppSec: "High",},
-		{Threadfix: "HIGH", InsightAppSec: "Critical",},
+		{Threadfix: "SAFE", InsightAppSec: "Info"},
+		{Threadfix: "INFORMATIONAL", InsightAppSec: "Low"},
+		{Threadfix: "LOW", InsightAppSec: "Medium"},
+		{Threadfix: "MEDIUM", InsightAppSec: "High"},
+		{Threadfix: "HIGH", InsightAppSec: "Critical"},
 	}
 	// Inject Severity Mappings that is usually provided by configuration
 	integration.SeverityMappings = severityMappings
@@ -238,4 +247,69 @@ func TestConvertScan(t *testing.T) {
 	} else {
 		t.Error("Number of findings mismatch after converting scan")
 	}
+	for _, finding := range threadfixScan.Findings {
+		if finding.Summary != "SQL Injection" || finding.ScannerRecommendation == "" {
+			t.Errorf("Expected module and attack documentation from InsightAppSec, got %+v", finding)
+		}
+		if finding.DynamicDetails.SurfaceLocation.HTTPMethod == "" ||
+			!strings.HasPrefix(finding.Metadata[integration.MetadataOriginalRequest],
+				finding.DynamicDetails.SurfaceLocation.HTTPMethod+" ") ||
+			finding.Metadata[integration.MetadataOriginalValue] == "" {
+			t.Errorf("Expected the HTTP method and original exchange, got %+v", finding)
+		}
+	}
+}
+
+// Local stand-in for the InsightAppSec API serving the module and attack documentation used by scan conversion, and the
+// app, scan config, and attack template recorded in scan metadata
+func insightAppSecStandIn() *httptest.Server {
+	return httptest.NewServer(insightAppSecStandInMux())
+}
+
+// Handler of the InsightAppSec stand in, for stand ins that serve further endpoints themselves
+func insightAppSecStandInMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/us/ias/v1/apps/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": "1550c422-2273-4f27-9674-31fc814f3558", "name": "Hackazon"}`)
+	})
+	mux.HandleFunc("/us/ias/v1/scan-configs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data": [{"id": "5b00b027-9a3d-402a-8f12-86bb761a19e6", "name": "Hackazon Full Scan", `+
+			`"attack_template": {"id": "11111111-0000-0000-0000-000000000000"}}], "metadata": {"total_data": 1}}`)
+	})
+	mux.HandleFunc("/us/ias/v1/attack-templates/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": "11111111-0000-0000-0000-000000000000", "name": "All Modules"}`)
+	})
+	mux.HandleFunc("/us/ias/v1/modules/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-key") != "insightappsec-test-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/documentation") {
+			fmt.Fprint(w, `{"references": {"CWE-89": "https://cwe.mitre.org/data/definitions/89.html"}, "description": "The attack injected SQL syntax.", `+
+				`"recommendation": "Use parameterized queries."}`)
+			return
+		}
+		fmt.Fprint(w, `{"id": "b6f559d3-74b5-451e-b424-a1c1fb264fa6", "name": "SQL Injection", `+
+			`"description": "SQL injection allows an attacker to run database queries.", "confidence": "HIGH"}`)
+	})
+	return mux
+}
+
+// Point the integration's clients at InsightAppSec and Threadfix stand ins, returning a function that restores the
+// clients and unmapped severity policy in use before
+func useStandIns(iasURL string, threadfixURL string) func() {
+	var iasClient, threadfixClient, unmapped = integration.IasClient, integration.ThreadfixClient,
+		integration.UnmappedSeverity
+	var apiClient = shared.APIClient{Config: shared.APIConfiguration{Timeout: 30, RestyClient: resty.New()}}
+	integration.IasClient = insightappsec.API{APIClient: apiClient, Config: insightappsec.InsightAppSecConfiguration{
+		Region: "us", APIKey: "insightappsec-test-key", BasePath: iasURL + "/{region}/ias/v1/"}}
+	integration.ThreadfixClient = threadfixStandInClient(threadfixURL)
+	// Scan configs fetched from other stand ins are not reused
+	integration.ResetRunCache()
+	return func() {
+		integration.IasClient = iasClient
+		integration.ThreadfixClient = threadfixClient
+		integration.UnmappedSeverity = unmapped
+		integration.ResetRunCache()
+	}
 }
@@ -0,0 +1,171 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/integration"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/shared"
+)
+
+func TestRotateEncryptionKey(t *testing.T) {
+	directory, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	configFile := shared.ConfigFile
+	defer func() { shared.ConfigFile = configFile }()
+	shared.ConfigFile = filepath.Join(directory, "settings.yml")
+	if value, exists := os.LookupEnv("R7_ENCRYPTION_KEY"); exists {
+		os.Unsetenv("R7_ENCRYPTION_KEY")
+		defer os.Setenv("R7_ENCRYPTION_KEY", value)
+	}
+
+	// Values encrypted with the original key file
+	settings := &integration.SettingsConf{}
+	settings.Connections.InsightAppSec.Apikey = shared.Encrypt("insightappsec-key")
+	settings.Connections.Threadfix.Apikey = "env:THREADFIX_API_KEY"
+	original := settings.Connections.InsightAppSec.Apikey
+	if !strings.HasPrefix(original, "(enc)") {
+		t.Fatalf("Expected original key to use the (enc) prefix, got %s", original)
+	}
+
+	keyId, reencrypted, err := integration.RotateEncryptionKey(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyId != "v2" || len(reencrypted) != 1 || reencrypted[0] != "connections.insightappsec.apikey" {
+		t.Errorf("Unexpected rotation result: %s %v", keyId, reencrypted)
+	}
+	if !strings.HasPrefix(settings.Connections.InsightAppSec.Apikey, "(enc:v2)") ||
+		decrypted(settings.Connections.InsightAppSec.Apikey) != "insightappsec-key" {
+		t.Errorf("Expected API key re-encrypted with v2, got %s", settings.Connections.InsightAppSec.Apikey)
+	}
+	if settings.Connections.Threadfix.Apikey != "env:THREADFIX_API_KEY" {
+		t.Error("Expected secret references to be left unchanged")
+	}
+
+	// Previous keys decrypt until pruned
+	if decrypted(original) != "insightappsec-key" {
+		t.Error("Expected value encrypted with the original key to decrypt after rotation")
+	}
+	removed, err := shared.PruneKeys(integration.EncryptionKeysInUse(settings))
+	if err != nil || len(removed) != 1 || removed[0] != "" {
+		t.Errorf("Expected the original key to be pruned, got %v (%v)", removed, err)
+	}
+	if decrypted(settings.Connections.InsightAppSec.Apikey) != "insightappsec-key" {
+		t.Error("Expected active key to remain after pruning")
+	}
+	if backups, _ := filepath.Glob(filepath.Join(directory, ".enc.key*.bak")); len(backups) != 0 {
+		t.Errorf("Expected no copy of the pruned key file, got %v", backups)
+	}
+}
+
+func TestDecryptErrors(t *testing.T) {
+	directory, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	configFile := shared.ConfigFile
+	defer func() { shared.ConfigFile = configFile }()
+	shared.ConfigFile = filepath.Join(directory, "settings.yml")
+	os.Setenv("R7_ENCRYPTION_KEY", "first-key")
+	defer os.Unsetenv("R7_ENCRYPTION_KEY")
+
+	encrypted := shared.Encrypt("threadfix-key")
+	os.Setenv("R7_ENCRYPTION_KEY", "second-key")
+
+	expected := map[string]shared.DecryptErrorKind{
+		encrypted:                  shared.DecryptWrongKey,
+		"(enc)not base64!":         shared.DecryptCorruptedValue,
+		"(enc)c2hvcnQ=":            shared.DecryptCorruptedValue,
+		"(enc:v9)" + encrypted[5:]: shared.DecryptMissingKey,
+	}
+	for value, kind := range expected {
+		_, err := shared.Decrypt(value)
+		if decryptError, ok := err.(*shared.DecryptError); !ok || decryptError.Kind != kind {
+			t.Errorf("Expected decrypt error of kind %d for %s, got %v", kind, value, err)
+		}
+	}
+
+	settings := &integration.SettingsConf{}
+	settings.Connections.Threadfix.Apikey = encrypted
+	settings.Connections.InsightAppSec.Apikey = "env:INSIGHTAPPSEC_API_KEY"
+	if decryptErrors := integration.CheckEncryptedSettings(settings); len(decryptErrors) != 1 ||
+		decryptErrors[0].Setting != "connections.threadfix.apikey" {
+		t.Errorf("Expected the Threadfix API key to fail to decrypt, got %v", decryptErrors)
+	}
+}
+
+func TestEnvironmentKeyPrecedence(t *testing.T) {
+	directory, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	configFile := shared.ConfigFile
+	defer func() { shared.ConfigFile = configFile }()
+	shared.ConfigFile = filepath.Join(directory, "settings.yml")
+	os.Setenv("R7_ENCRYPTION_KEY", "environment-key")
+	defer os.Unsetenv("R7_ENCRYPTION_KEY")
+	encrypted := shared.Encrypt("threadfix-key")
+
+	// A stale key file must not override the key provided by the environment
+	if err := ioutil.WriteFile(filepath.Join(directory, ".enc.key"), []byte("stale-key"), 0400); err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, err := shared.Decrypt(encrypted); err != nil || plaintext != "threadfix-key" {
+		t.Errorf("Expected the environment key to decrypt the value, got %q (%v)", plaintext, err)
+	}
+}
+
+func TestRotateLegacyKeyWithTrailingNewline(t *testing.T) {
+	directory, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	configFile := shared.ConfigFile
+	defer func() { shared.ConfigFile = configFile }()
+	shared.ConfigFile = filepath.Join(directory, "settings.yml")
+	if value, exists := os.LookupEnv("R7_ENCRYPTION_KEY"); exists {
+		os.Unsetenv("R7_ENCRYPTION_KEY")
+		defer os.Setenv("R7_ENCRYPTION_KEY", value)
+	}
+
+	// Original key files edited by hand often end with a newline, which is part of the key
+	if err := ioutil.WriteFile(filepath.Join(directory, ".enc.key"), []byte("original-key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	original := shared.Encrypt("insightappsec-key")
+
+	if _, err := shared.RotateKey(); err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, err := shared.Decrypt(original); err != nil || plaintext != "insightappsec-key" {
+		t.Errorf("Expected the original key to still decrypt its values after rotation, got %q (%v)", plaintext, err)
+	}
+
+	// The original key survives the key file being rewritten again
+	if _, err := shared.RotateKey(); err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, err := shared.Decrypt(original); err != nil || plaintext != "insightappsec-key" {
+		t.Errorf("Expected the original key to decrypt its values after a second rotation, got %q (%v)", plaintext,
+			err)
+	}
+}
+
+func decrypted(value string) string {
+	plaintext, _ := shared.Decrypt(value)
+	return plaintext
+}
@@ -0,0 +1,85 @@
+package test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/insightappsec"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/threadfix"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/integration"
+)
+
+func TestMapAttackDocumentation(t *testing.T) {
+	attackDoc := insightappsec.AttackDocumentation{References: map[string]string{
+		"CWE-943":           "https://cwe.mitre.org/data/definitions/943.html",
+		"CWE89":             "https://cwe.mitre.org/data/definitions/89.html",
+		"OWASP-2017-A1":     "https://owasp.org/www-project-top-ten/2017/A1_2017-Injection",
+		"CAPEC-66":          "https://capec.mitre.org/data/definitions/66.html",
+		"WASC 19":           "http://projects.webappsec.org/w/page/13246963/SQL%20Injection",
+		"PCI-DSS-6.5.1":     "https://www.pcisecuritystandards.org/",
+		"NIST:SI-10":        "https://nvd.nist.gov/800-53/Rev4/control/SI-10",
+		"Rapid7-SQLi-Guide": "https://www.rapid7.com/fundamentals/sql-injection-attacks/",
+	}}
+	expected := []threadfix.Mapping{
+		{MappingType: threadfix.MappingTypeCWE, Value: "89", Primary: true},
+		{MappingType: threadfix.MappingTypeCWE, Value: "943"},
+		{MappingType: threadfix.MappingTypeOWASP, Value: "2017-A1"},
+		{MappingType: threadfix.MappingTypeCAPEC, Value: "66"},
+		{MappingType: threadfix.MappingTypeWASC, Value: "19"},
+		{MappingType: threadfix.MappingTypePCI, Value: "6.5.1"},
+		{MappingType: threadfix.MappingTypeNIST, Value: "SI-10"},
+		{MappingType: threadfix.ToolVendor, Value: "Rapid7-SQLi-Guide", VendorOtherType: "Rapid7"},
+	}
+
+	// Map iteration order must not change the mappings or which CWE is primary
+	for i := 0; i < 20; i++ {
+		if mappings := integration.MapAttackDocumentation("", attackDoc); !reflect.DeepEqual(mappings, expected) {
+			t.Fatalf("Expected %+v, got %+v", expected, mappings)
+		}
+	}
+}
+
+func TestMapAttackDocumentationFallbackCWE(t *testing.T) {
+	defer func(cweMappings []integration.CWEMapping) {
+		integration.CWEMappings = cweMappings
+	}(integration.CWEMappings)
+	integration.CWEMappings = []integration.CWEMapping{{Module: "B6F559D3-74B5-451E-B424-A1C1FB264FA6", CWE: "CWE-89"}}
+
+	attackDoc := insightappsec.AttackDocumentation{References: map[string]string{"OWASP-2017-A1": ""}}
+	mappings := integration.MapAttackDocumentation("b6f559d3-74b5-451e-b424-a1c1fb264fa6", attackDoc)
+	if len(mappings) != 2 || mappings[0] != (threadfix.Mapping{MappingType: threadfix.MappingTypeCWE, Value: "89",
+		Primary: true}) {
+		t.Errorf("Expected the module's fallback CWE as the primary mapping, got %+v", mappings)
+	}
+
+	// A referenced CWE takes precedence over the fallback
+	attackDoc.References["CWE-943"] = ""
+	mappings = integration.MapAttackDocumentation("b6f559d3-74b5-451e-b424-a1c1fb264fa6", attackDoc)
+	if len(mappings) != 2 || mappings[0].Value != "943" {
+		t.Errorf("Expected the referenced CWE, got %+v", mappings)
+	}
+
+	if mappings := integration.MapAttackDocumentation("another-module", insightappsec.AttackDocumentation{}); len(mappings) != 0 {
+		t.Errorf("Expected no mappings for a module without a fallback CWE, got %+v", mappings)
+	}
+}
+
+func TestParseReference(t *testing.T) {
+	for key, expected := range map[string]threadfix.Mapping{
+		"OWASP_2017_A1":  {MappingType: threadfix.MappingTypeOWASP, Value: "2017_A1"},
+		"CAPEC66":        {MappingType: threadfix.MappingTypeCAPEC, Value: "66"},
+		"PCIDSS 6.5.1":   {MappingType: threadfix.MappingTypePCI, Value: "6.5.1"},
+		"PCI DSS: 6.5.1": {MappingType: threadfix.MappingTypePCI, Value: "6.5.1"},
+		// A standard's name followed by another word is the start of another name, not a reference to the standard
+		"OWASPZAP-1":   {MappingType: threadfix.ToolVendor, Value: "OWASPZAP-1", VendorOtherType: "OWASPZAP"},
+		"CAPECTOOL-2":  {MappingType: threadfix.ToolVendor, Value: "CAPECTOOL-2", VendorOtherType: "CAPECTOOL"},
+		"NISTIR-8011":  {MappingType: threadfix.ToolVendor, Value: "NISTIR-8011", VendorOtherType: "NISTIR"},
+		"PCIe-Spec":    {MappingType: threadfix.ToolVendor, Value: "PCIe-Spec", VendorOtherType: "PCIe"},
+		"CWEs-Top-25":  {MappingType: threadfix.ToolVendor, Value: "CWEs-Top-25", VendorOtherType: "CWEs"},
+		"WASCLY-Guide": {MappingType: threadfix.ToolVendor, Value: "WASCLY-Guide", VendorOtherType: "WASCLY"},
+	} {
+		if mapping := integration.ParseReference(key); mapping != expected {
+			t.Errorf("Expected %q to be parsed as %+v, got %+v", key, expected, mapping)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/insightappsec"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/threadfix"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/integration"
+)
+
+func TestScanMetadata(t *testing.T) {
+	defer func(toolVersion string) {
+		integration.ToolVersion = toolVersion
+	}(integration.ToolVersion)
+	integration.ToolVersion = "1.0.1"
+
+	var scan insightappsec.Scan
+	scan.ID = "3113af46-29cb-4f93-92e5-eddfbac4ed2c"
+	scan.App.ID = "1550c422-2273-4f27-9674-31fc814f3558"
+	scan.ScanConfig.ID = "5b00b027-9a3d-402a-8f12-86bb761a19e6"
+	scan.Submitter.Type = "ORGANIZATION"
+	scan.SubmitTime = "2019-08-05T18:10:17.189"
+	scan.CompletionTime = "2019-08-05T18:13:56.913"
+	scan.Status = "COMPLETE"
+	vulnerability := insightappsec.Vulnerability{ID: "fa7adfb4-81e9-46a1-b55b-732c4d4b474d", Severity: "HIGH",
+		Status: "UNREVIEWED"}
+
+	threadfixScan := integration.ConvertScan(scan, []insightappsec.Vulnerability{vulnerability})
+
+	for key, expected := range map[string]string{
+		"InsightAppSec Application":     "Hackazon",
+		"InsightAppSec Scan Config":     "Hackazon Full Scan",
+		"InsightAppSec Attack Template": "All Modules",
+		"InsightAppSec Submitter":       "ORGANIZATION",
+		"InsightAppSec Scan Status":     "COMPLETE",
+		"InsightAppSec Scan Duration":   "3m39s",
+		"Integration Version":           "1.0.1",
+	} {
+		if threadfixScan.Metadata[key] != expected {
+			t.Errorf("Expected scan metadata %q to be %q, got %q", key, expected, threadfixScan.Metadata[key])
+		}
+	}
+	if link := threadfixScan.Metadata["InsightAppSec Scan Link"]; !strings.HasPrefix(link, "https://us.") ||
+		!strings.HasSuffix(link, "/apps/"+scan.App.ID+"/scans/"+scan.ID) {
+		t.Errorf("Expected a link to the scan in the InsightAppSec console, got %q", link)
+	}
+
+	expectedSummary := "InsightAppSec scan of Hackazon with scan config Hackazon Full Scan (attack template " +
+		"All Modules), COMPLETE at 2019-08-05T18:13:56Z after 3m39s. Application ID: " + scan.App.ID +
+		", Scan ID: " + scan.ID
+	if threadfixScan.ExecutiveSummary != expectedSummary {
+		t.Errorf("Expected executive summary %q, got %q", expectedSummary, threadfixScan.ExecutiveSummary)
+	}
+
+	finding := threadfixScan.Findings[0]
+	if finding.Metadata["InsightAppSec Vulnerability Status"] != "UNREVIEWED" ||
+		!strings.HasSuffix(finding.Metadata["InsightAppSec Vulnerability Link"], "/vulnerabilities/"+vulnerability.ID) {
+		t.Errorf("Expected the vulnerability status and link, got %v", finding.Metadata)
+	}
+}
+
+func TestConfiguredMetadata(t *testing.T) {
+	mux := insightAppSecStandInMux()
+	mux.HandleFunc("/us/ias/v1/search", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data": [{"id": "vuln-1", "severity": "HIGH", "status": "VERIFIED"}], "metadata": {"total_data": 1}}`)
+	})
+	ias := httptest.NewServer(mux)
+	defer ias.Close()
+
+	var received []threadfix.ThreadfixScan
+	var receivedErr error
+	tf := threadfixUploadStandIn(&received, &receivedErr)
+	defer tf.Close()
+
+	defer useStandIns(ias.URL, tf.URL)()
+	integration.IasClient.Config.ConsolePath = "https://console.example.com/"
+
+	var scan insightappsec.Scan
+	scan.ID = "3113af46-29cb-4f93-92e5-eddfbac4ed2c"
+	scan.App.ID = "1550c422-2273-4f27-9674-31fc814f3558"
+	var metadata = integration.MetadataConf{
+		Scan: []integration.MetadataTemplate{
+			// Replaces the default template of the key, ignoring case
+			{Key: "insightappsec application", Template: "{{.AppName}} ({{.AppID}})"},
+			{Key: "Integration Version", Template: ""},
+			{Key: "Source", Template: "InsightAppSec"},
+		},
+		Finding: []integration.MetadataTemplate{{Key: "InsightAppSec Vulnerability Link", Template: ""}},
+	}
+	if !integration.UploadScan(threadfix.Application{}, scan, integration.ExportConfiguration{Metadata: metadata}) {
+		t.Fatalf("Expected scan to be uploaded: %v", receivedErr)
+	}
+
+	uploaded := received[0]
+	if uploaded.Metadata["InsightAppSec Application"] != "Hackazon (1550c422-2273-4f27-9674-31fc814f3558)" ||
+		uploaded.Metadata["Source"] != "InsightAppSec" {
+		t.Errorf("Expected the configured scan metadata, got %v", uploaded.Metadata)
+	}
+	if _, ok := uploaded.Metadata["Integration Version"]; ok {
+		t.Errorf("Expected metadata with an empty template to be omitted, got %v", uploaded.Metadata)
+	}
+	if link := uploaded.Metadata["InsightAppSec Scan Link"]; link != "https://console.example.com/#/apps/"+
+		scan.App.ID+"/scans/"+scan.ID {
+		t.Errorf("Expected a link to the scan in the configured console, got %q", link)
+	}
+	if finding := uploaded.Findings[0]; finding.Metadata["InsightAppSec Vulnerability Status"] != "VERIFIED" ||
+		finding.Metadata["InsightAppSec Vulnerability Link"] != "" {
+		t.Errorf("Expected only the vulnerability status, got %v", finding.Metadata)
+	}
+}
+
+func TestInsightAppSecDataFetchedOncePerRun(t *testing.T) {
+	standIn := insightAppSecStandInMux()
+	var requests = make(map[string]int)
+	var failScanConfigs bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		endpoint := strings.Split(strings.TrimPrefix(r.URL.Path, "/us/ias/v1/"), "/")[0]
+		requests[endpoint]++
+		if endpoint == "scan-configs" && failScanConfigs {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		standIn.ServeHTTP(w, r)
+	})
+	mux.HandleFunc("/us/ias/v1/search", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data": [{"id": "vuln-1", "severity": "HIGH"}], "metadata": {"total_data": 1}}`)
+	})
+	ias := httptest.NewServer(mux)
+	defer ias.Close()
+
+	var received []threadfix.ThreadfixScan
+	var receivedErr error
+	tf := threadfixUploadStandIn(&received, &receivedErr)
+	defer tf.Close()
+
+	defer useStandIns(ias.URL, tf.URL)()
+
+	var scans = make([]insightappsec.Scan, 3)
+	for index := range scans {
+		scans[index].ID = fmt.Sprintf("scan-%d", index)
+		scans[index].App.ID = "1550c422-2273-4f27-9674-31fc814f3558"
+		scans[index].ScanConfig.ID = "5b00b027-9a3d-402a-8f12-86bb761a19e6"
+	}
+
+	// A failed fetch is reported rather than matching the filter against an unknown scan config, and is not cached
+	failScanConfigs = true
+	if filtered, err := integration.FilterByScanConfig(scans, "^Hackazon"); err == nil || len(filtered) != 0 {
+		t.Errorf("Expected the failed scan config fetch to be reported, got %d scan(s) (%v)", len(filtered), err)
+	}
+	failScanConfigs = false
+	if filtered, err := integration.FilterByScanConfig(scans, "^Hackazon"); err != nil || len(filtered) != len(scans) {
+		t.Fatalf("Expected every scan to match its scan config, got %d (%v)", len(filtered), err)
+	}
+
+	for _, scan := range scans {
+		if !integration.UploadScan(threadfix.Application{}, scan, integration.ExportConfiguration{}) {
+			t.Fatalf("Expected scan %s to be uploaded: %v", scan.ID, receivedErr)
+		}
+	}
+
+	// One failed and one successful scan config fetch, then each app and attack template once
+	for endpoint, expected := range map[string]int{"scan-configs": 2, "apps": 1, "attack-templates": 1} {
+		if requests[endpoint] != expected {
+			t.Errorf("Expected %d %s request(s), got %d", expected, endpoint, requests[endpoint])
+		}
+	}
+	for _, uploaded := range received {
+		if uploaded.Metadata["InsightAppSec Scan Config"] != "Hackazon Full Scan" ||
+			uploaded.Metadata["InsightAppSec Attack Template"] != "All Modules" {
+			t.Errorf("Expected the scan config and attack template in the scan metadata, got %v", uploaded.Metadata)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/insightappsec"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/threadfix"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/integration"
+)
+
+func TestQuoteSearchValue(t *testing.T) {
+	for value, expected := range map[string]string{
+		"Hackazon":       `'Hackazon'`,
+		"Bob's App":      `'Bob\'s App'`,
+		`C:\apps\' OR '`: `'C:\\apps\\\' OR \''`,
+	} {
+		if quoted := insightappsec.QuoteSearchValue(value); quoted != expected {
+			t.Errorf("Expected %s to be quoted as %s, got %s", value, expected, quoted)
+		}
+	}
+}
+
+func TestSearchQueries(t *testing.T) {
+	var queries []string
+	ias := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var search insightappsec.SearchParameters
+		json.NewDecoder(r.Body).Decode(&search)
+		queries = append(queries, search.Query)
+		switch search.Type {
+		case insightappsec.AppSearchType:
+			fmt.Fprint(w, `{"data": [{"id": "eb3ae5b3-01ef-4a8b-a5f8-1da2e1a9e1b6", "name": "Bob's App"}],
+				"metadata": {"total_data": 1}}`)
+		case insightappsec.ScanSearchType:
+			fmt.Fprint(w, `{"data": [{"id": "3113af46-29cb-4f93-92e5-eddfbac4ed2c",
+				"app": {"id": "eb3ae5b3-01ef-4a8b-a5f8-1da2e1a9e1b6"}, "status": "COMPLETE"}],
+				"metadata": {"total_data": 1}}`)
+		default:
+			fmt.Fprint(w, `{"data": [], "metadata": {"total_data": 0}}`)
+		}
+	}))
+	defer ias.Close()
+
+	var received []threadfix.ThreadfixScan
+	var receivedErr error
+	tf := threadfixUploadStandIn(&received, &receivedErr)
+	defer tf.Close()
+
+	defer useStandIns(ias.URL, tf.URL)()
+
+	// Plain names are quoted
+	integration.IasClient.GetAppsByName("Bob's App")
+	if expected := []string{`app.name LIKE 'Bob\'s App'`}; !reflect.DeepEqual(queries, expected) {
+		t.Errorf("Expected queries %v, got %v", expected, queries)
+	}
+
+	// The app query replaces the application scope, and the scan query is combined with each app's ID
+	queries = nil
+	exportConfiguration := integration.ExportConfiguration{Name: "Query Import", ApplicationScope: "Hackazon",
+		AppQuery: "app.name LIKE 'Bob' || app.name LIKE 'Hackazon'", ScanQuery: "scan.status='COMPLETE'"}
+	integration.ImportInitialScans(threadfix.Application{}, true, 0, exportConfiguration.ApplicationScope,
+		exportConfiguration.ScanConfigFilter, nil, exportConfiguration)
+
+	expected := []string{
+		"app.name LIKE 'Bob' || app.name LIKE 'Hackazon'",
+		"scan.app.id='eb3ae5b3-01ef-4a8b-a5f8-1da2e1a9e1b6' && (scan.status='COMPLETE')",
+	}
+	if len(queries) < len(expected) || !reflect.DeepEqual(queries[:len(expected)], expected) {
+		t.Errorf("Expected queries to start with %v, got %v", expected, queries)
+	}
+}
+
+func TestValidateSearchQueries(t *testing.T) {
+	for query, valid := range map[string]bool{
+		"":                        true,
+		"scan.status='COMPLETE'":  true,
+		`app.name='Bob\'s (App'`:  true,
+		"(scan.status='COMPLETE'": false,
+		"scan.status='COMPLETE')": false,
+		"app.name='Hackazon":      false,
+		"(app.name='A' || app.name='B') && app.id='C'": true,
+	} {
+		settings := &integration.SettingsConf{ExportConfigurations: []integration.ExportConfiguration{
+			{Name: "Query Import", ScanQuery: query}}}
+		var reported = false
+		for _, validationError := range integration.ValidateConfiguration(settings) {
+			reported = reported || validationError.Setting == "exportConfigurations[Query Import].scan_query"
+		}
+		if reported == valid {
+			t.Errorf("Expected query %q to be valid: %t", query, valid)
+		}
+	}
+}
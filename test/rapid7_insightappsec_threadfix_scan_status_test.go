@@ -0,0 +1,99 @@
+package test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/insightappsec"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/threadfix"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/integration"
+)
+
+func TestFilterByStatus(t *testing.T) {
+	var scans = []insightappsec.Scan{
+		{ID: "complete", Status: "COMPLETE"},
+		{ID: "running", Status: "RUNNING"},
+		{ID: "failed", Status: "FAILED", FailureReason: "Authentication failed"},
+		{ID: "canceled", Status: "CANCELED"},
+	}
+
+	for _, test := range []struct {
+		statuses []string
+		expected string
+	}{
+		{statuses: nil, expected: "complete"},
+		{statuses: []string{"complete", "Failed"}, expected: "complete,failed"},
+		{statuses: []string{"RUNNING"}, expected: "running"},
+	} {
+		var ids []string
+		for _, scan := range integration.FilterByStatus(scans, test.statuses) {
+			ids = append(ids, scan.ID)
+		}
+		if strings.Join(ids, ",") != test.expected {
+			t.Errorf("Expected scans %s with statuses %v, got %v", test.expected, test.statuses, ids)
+		}
+	}
+}
+
+func TestEmptyScans(t *testing.T) {
+	var search string
+	mux := insightAppSecStandInMux()
+	mux.HandleFunc("/us/ias/v1/search", func(w http.ResponseWriter, r *http.Request) {
+		if search == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, search)
+	})
+	ias := httptest.NewServer(mux)
+	defer ias.Close()
+
+	var received []threadfix.ThreadfixScan
+	var receivedErr error
+	tf := threadfixUploadStandIn(&received, &receivedErr)
+	defer tf.Close()
+
+	defer useStandIns(ias.URL, tf.URL)()
+	integration.UnmappedSeverity = integration.UnmappedSeverityConf{Policy: integration.UnmappedSeverityPolicySkip}
+
+	const noVulnerabilities = `{"data": [], "metadata": {"total_data": 0}}`
+	// Only a complete scan whose vulnerabilities were all fetched is uploaded without findings; an empty scan of an
+	// incomplete run would close every open vulnerability in Threadfix. A complete scan whose vulnerabilities were all
+	// skipped or filtered is uploaded so Threadfix closes them.
+	for _, test := range []struct {
+		description string
+		status      string
+		search      string
+		filters     integration.FilterConf
+		uploaded    bool
+	}{
+		{description: "complete scan without vulnerabilities", status: "COMPLETE", search: noVulnerabilities,
+			uploaded: true},
+		{description: "failed scan", status: "FAILED", search: noVulnerabilities},
+		{description: "failed search", status: "COMPLETE"},
+		{description: "first page missing vulnerabilities", status: "COMPLETE",
+			search: `{"data": [], "metadata": {"total_data": 3}}`},
+		{description: "every finding skipped", status: "COMPLETE",
+			search: `{"data": [{"id": "safe", "severity": "SAFE"}], "metadata": {"total_data": 1}}`, uploaded: true},
+		{description: "every finding filtered", status: "COMPLETE", filters: integration.FilterConf{MinSeverity: "HIGH"},
+			search: `{"data": [{"id": "low", "severity": "LOW"}], "metadata": {"total_data": 1}}`, uploaded: true},
+		{description: "every finding filtered of a failed scan", status: "FAILED",
+			filters: integration.FilterConf{MinSeverity: "HIGH"},
+			search:  `{"data": [{"id": "low", "severity": "LOW"}], "metadata": {"total_data": 1}}`},
+	} {
+		received = nil
+		search = test.search
+		var scan = insightappsec.Scan{ID: "3113af46-29cb-4f93-92e5-eddfbac4ed2c", Status: test.status}
+		uploaded := integration.UploadScan(threadfix.Application{}, scan,
+			integration.ExportConfiguration{Filters: test.filters})
+		if uploaded != test.uploaded || len(received) != map[bool]int{true: 1}[test.uploaded] {
+			t.Errorf("%s: expected uploaded to be %t, got %t with %d upload(s)", test.description, test.uploaded,
+				uploaded, len(received))
+		} else if uploaded && len(received[0].Findings) != 0 {
+			t.Errorf("%s: expected an empty scan, got %d finding(s)", test.description, len(received[0].Findings))
+		}
+	}
+}
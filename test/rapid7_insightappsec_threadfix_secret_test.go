@@ -0,0 +1,42 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/shared"
+)
+
+func TestResolveSecret(t *testing.T) {
+	os.Setenv("THREADFIX_TEST_API_KEY", "from-environment")
+	defer os.Unsetenv("THREADFIX_TEST_API_KEY")
+
+	secretFile, err := ioutil.TempFile("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(secretFile.Name())
+	secretFile.WriteString("from-file\n")
+	secretFile.Close()
+
+	references := map[string]string{
+		"env:THREADFIX_TEST_API_KEY": "from-environment",
+		"file:" + secretFile.Name():  "from-file",
+		"plain-api-key":              "plain-api-key",
+	}
+	if runtime.GOOS != "windows" {
+		references["cmd:echo from-command"] = "from-command"
+	}
+
+	for reference, expected := range references {
+		if secret, err := shared.ResolveSecret(reference); err != nil || secret != expected {
+			t.Errorf("Expected %s to resolve to %s, got %s (%v)", reference, expected, secret, err)
+		}
+	}
+
+	if _, err := shared.ResolveSecret("env:THREADFIX_TEST_UNSET_API_KEY"); err == nil {
+		t.Error("Expected an error resolving an unset environment variable")
+	}
+}
@@ -0,0 +1,58 @@
+package test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/integration"
+)
+
+func TestNonInteractiveConfiguration(t *testing.T) {
+	settings := &integration.SettingsConf{}
+
+	if err := integration.SetConfigurationValue(settings, "connections.threadfix.host", "https://threadfix"); err != nil {
+		t.Fatal(err)
+	}
+	integration.AddExportConfiguration(settings, integration.ExportConfiguration{Name: "Hackazon Import"})
+	if err := integration.SetConfigurationValue(settings, "exportconfigurations.Hackazon Import.initial_import_max_days",
+		"90"); err != nil {
+		t.Fatal(err)
+	}
+
+	patch := `
+connections:
+  threadfix:
+    port: "8443"
+severityMappings:
+- insightappsec: HIGH
+  threadfix: Critical
+`
+	if err := integration.ApplyConfigurationPatch(settings, []byte(patch)); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("R7_IAS_TF_EXPORTCONFIGURATIONS_0_ENABLED", "true")
+	defer os.Unsetenv("R7_IAS_TF_EXPORTCONFIGURATIONS_0_ENABLED")
+	if err := integration.ApplyEnvironmentOverrides(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	if settings.Connections.Threadfix.Host != "https://threadfix" || settings.Connections.Threadfix.Port != "8443" {
+		t.Errorf("Unexpected Threadfix connection: %+v", settings.Connections.Threadfix)
+	}
+	if len(settings.SeverityMappings) != 1 || settings.SeverityMappings[0].Threadfix != "Critical" {
+		t.Errorf("Unexpected severity mappings: %+v", settings.SeverityMappings)
+	}
+	if exportConfiguration := settings.ExportConfigurations[0]; exportConfiguration.InitialImportMaxDays != 90 ||
+		!exportConfiguration.Enabled {
+		t.Errorf("Unexpected export configuration: %+v", exportConfiguration)
+	}
+
+	if err := integration.SetConfigurationValue(settings, "connections.threadfix.hostname", "x"); err == nil {
+		t.Error("Expected an error for an unknown setting")
+	}
+	if err := integration.RemoveExportConfiguration(settings, "Hackazon Import"); err != nil ||
+		len(settings.ExportConfigurations) != 0 {
+		t.Errorf("Expected export configuration to be removed: %v", err)
+	}
+}
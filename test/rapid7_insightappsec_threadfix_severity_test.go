@@ -0,0 +1,205 @@
+package test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/insightappsec"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/threadfix"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/integration"
+)
+
+const sqlInjectionModule = "b6f559d3-74b5-451e-b424-a1c1fb264fa6"
+
+func TestMapFindingSeverity(t *testing.T) {
+	defer func(severityMappings []integration.SeverityMapping) {
+		integration.SeverityMappings = severityMappings
+	}(integration.SeverityMappings)
+	integration.SeverityMappings = []integration.SeverityMapping{
+		{InsightAppSec: "MEDIUM", Threadfix: "Medium"},
+		{InsightAppSec: "MEDIUM", Threadfix: "High", CWE: "CWE-89"},
+		{InsightAppSec: "MEDIUM", Threadfix: "Critical", Module: sqlInjectionModule},
+		{InsightAppSec: "MEDIUM", Threadfix: "Info", Module: sqlInjectionModule, CWE: "943"},
+	}
+
+	for _, test := range []struct {
+		module   string
+		cwe      string
+		expected string
+	}{
+		{module: "", cwe: "", expected: "Medium"},
+		{module: "another-module", cwe: "79", expected: "Medium"},
+		{module: "another-module", cwe: "89", expected: "High"},
+		{module: sqlInjectionModule, cwe: "89", expected: "Critical"},
+		{module: sqlInjectionModule, cwe: "943", expected: "Info"},
+	} {
+		if severity, err := integration.MapFindingSeverity("medium", test.module, test.cwe); err != nil ||
+			severity != test.expected {
+			t.Errorf("Expected module %q and CWE %q to map to %s, got %s (%v)", test.module, test.cwe,
+				test.expected, severity, err)
+		}
+	}
+	if _, err := integration.MapFindingSeverity("HIGH", sqlInjectionModule, "89"); err == nil {
+		t.Error("Expected an error for an unmapped severity")
+	}
+}
+
+func TestUnmappedSeverityPolicy(t *testing.T) {
+	mux := insightAppSecStandInMux()
+	mux.HandleFunc("/us/ias/v1/search", func(w http.ResponseWriter, r *http.Request) {
+		// Only SAFE is unmapped by the test severity mappings
+		fmt.Fprintf(w, `{"data": [
+			{"id": "vuln-1", "severity": "SAFE", "variances": [{"module": {"id": "%[1]s"}, "attack": {"id": "1"}}]},
+			{"id": "vuln-2", "severity": "Critical", "vulnerability_score": 9.8,
+				"vector_string": "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H",
+				"variances": [{"module": {"id": "%[1]s"}, "attack": {"id": "1"}}]}
+		], "metadata": {"total_data": 2}}`, sqlInjectionModule)
+	})
+	ias := httptest.NewServer(mux)
+	defer ias.Close()
+
+	var received []threadfix.ThreadfixScan
+	var receivedErr error
+	tf := threadfixUploadStandIn(&received, &receivedErr)
+	defer tf.Close()
+
+	defer useStandIns(ias.URL, tf.URL)()
+
+	for _, test := range []struct {
+		unmapped    integration.UnmappedSeverityConf
+		uploaded    bool
+		numFindings int
+		severity    string
+	}{
+		// Unmapped findings are skipped unless there is a default severity, and never uploaded as Unknown
+		{unmapped: integration.UnmappedSeverityConf{}, uploaded: true, numFindings: 1},
+		{unmapped: integration.UnmappedSeverityConf{Default: "Low"}, uploaded: true, numFindings: 2, severity: "Low"},
+		{unmapped: integration.UnmappedSeverityConf{Policy: "default", Default: "Low"}, uploaded: true,
+			numFindings: 2, severity: "Low"},
+		{unmapped: integration.UnmappedSeverityConf{Policy: "default"}, uploaded: false},
+		{unmapped: integration.UnmappedSeverityConf{Policy: "skip"}, uploaded: true, numFindings: 1},
+		{unmapped: integration.UnmappedSeverityConf{Policy: "fail"}, uploaded: false},
+	} {
+		received = nil
+		integration.UnmappedSeverity = test.unmapped
+		scan := insightappsec.Scan{ID: "3113af46-29cb-4f93-92e5-eddfbac4ed2c"}
+		if integration.UploadScan(threadfix.Application{}, scan, integration.ExportConfiguration{}) != test.uploaded {
+			t.Fatalf("%+v: expected upload %t", test.unmapped, test.uploaded)
+		}
+		if !test.uploaded {
+			if len(received) != 0 {
+				t.Errorf("%+v: expected the upload to be aborted, got %+v", test.unmapped, received)
+			}
+			continue
+		}
+
+		findings := received[0].Findings
+		if len(findings) != test.numFindings {
+			t.Fatalf("%+v: expected %d finding(s), got %d", test.unmapped, test.numFindings, len(findings))
+		}
+		if test.numFindings == 2 && findings[0].Severity != test.severity {
+			t.Errorf("%+v: expected severity %s, got %s", test.unmapped, test.severity, findings[0].Severity)
+		}
+
+		// Mapped findings keep their CVSS data and module confidence
+		mapped := findings[len(findings)-1]
+		if mapped.Severity != "HIGH" || mapped.Metadata[integration.MetadataCVSSScore] != "9.8" ||
+			mapped.Metadata[integration.MetadataCVSSVector] == "" || mapped.Metadata[integration.MetadataConfidence] != "HIGH" {
+			t.Errorf("%+v: expected the mapped severity, CVSS data, and confidence, got %+v", test.unmapped, mapped)
+		}
+	}
+}
+
+func TestResolveSeverityMappings(t *testing.T) {
+	defer func(threadfixClient threadfix.API, severityMappings []integration.SeverityMapping,
+		unmapped integration.UnmappedSeverityConf) {
+		integration.ThreadfixClient = threadfixClient
+		integration.SeverityMappings = severityMappings
+		integration.UnmappedSeverity = unmapped
+	}(integration.ThreadfixClient, integration.SeverityMappings, integration.UnmappedSeverity)
+
+	// High has been renamed to Important, with a custom display name
+	tf := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"success": true, "object": [
+			{"id": 3, "name": "Medium", "intValue": 3, "displayName": "Medium"},
+			{"id": 4, "name": "Important", "intValue": 4, "customName": "P2", "displayName": "P2"},
+			{"id": 5, "name": "Critical", "intValue": 5, "displayName": "Critical"}]}`)
+	}))
+	defer tf.Close()
+	integration.ThreadfixClient = threadfixStandInClient(tf.URL)
+	if err := integration.NegotiateThreadfixVersion("latest"); err != nil {
+		t.Fatal(err)
+	}
+
+	integration.SeverityMappings = []integration.SeverityMapping{
+		{InsightAppSec: "MEDIUM", Threadfix: "High", ThreadfixIntValue: 4},
+		{InsightAppSec: "HIGH", Threadfix: "critical"},
+		{InsightAppSec: "LOW", Threadfix: "P2"},
+	}
+	integration.UnmappedSeverity = integration.UnmappedSeverityConf{Default: "medium"}
+	if err := integration.ResolveSeverityMappings(); err != nil {
+		t.Fatal(err)
+	}
+	for index, expected := range []integration.SeverityMapping{
+		{InsightAppSec: "MEDIUM", Threadfix: "Important", ThreadfixIntValue: 4},
+		{InsightAppSec: "HIGH", Threadfix: "Critical", ThreadfixIntValue: 5},
+		{InsightAppSec: "LOW", Threadfix: "Important", ThreadfixIntValue: 4},
+	} {
+		if integration.SeverityMappings[index] != expected {
+			t.Errorf("Expected %+v, got %+v", expected, integration.SeverityMappings[index])
+		}
+	}
+	if integration.UnmappedSeverity.Default != "Medium" {
+		t.Errorf("Expected the unmapped severity default to be resolved, got %s", integration.UnmappedSeverity.Default)
+	}
+
+	// Severities that no longer exist are reported rather than uploaded
+	integration.SeverityMappings = []integration.SeverityMapping{
+		{InsightAppSec: "SAFE", Threadfix: "Info"},
+		{InsightAppSec: "HIGH", Threadfix: "Critical", ThreadfixIntValue: 6},
+	}
+	if err := integration.ResolveSeverityMappings(); err == nil || !strings.Contains(err.Error(), `"Info"`) ||
+		!strings.Contains(err.Error(), "int value 6") {
+		t.Errorf("Expected both unresolved severities to be reported, got %v", err)
+	}
+}
+
+func TestSyncSeverityMappings(t *testing.T) {
+	// High has been renamed to Important
+	severities := []threadfix.VulnerabilitySeverity{
+		{Name: "Medium", IntValue: 3, DisplayName: "Medium"},
+		{Name: "Important", IntValue: 4, CustomName: "P2", DisplayName: "P2"},
+	}
+	settings := &integration.SettingsConf{
+		SeverityMappings: []integration.SeverityMapping{
+			{InsightAppSec: "MEDIUM", Threadfix: "medium"},
+			{InsightAppSec: "HIGH", Threadfix: "High", ThreadfixIntValue: 4},
+		},
+		UnmappedSeverity: integration.UnmappedSeverityConf{Default: "P2"},
+	}
+
+	if err := integration.SyncSeverityMappings(settings, severities); err != nil {
+		t.Fatal(err)
+	}
+	expected := []integration.SeverityMapping{
+		{InsightAppSec: "MEDIUM", Threadfix: "Medium", ThreadfixIntValue: 3},
+		{InsightAppSec: "HIGH", Threadfix: "Important", ThreadfixIntValue: 4},
+	}
+	if !reflect.DeepEqual(settings.SeverityMappings, expected) || settings.UnmappedSeverity.Default != "Important" {
+		t.Errorf("Expected the int value and current name of each severity, got %+v and %+v",
+			settings.SeverityMappings, settings.UnmappedSeverity)
+	}
+
+	// Nothing is stored when a severity does not exist
+	settings.SeverityMappings = append(settings.SeverityMappings,
+		integration.SeverityMapping{InsightAppSec: "LOW", Threadfix: "Low"})
+	settings.SeverityMappings[0].ThreadfixIntValue = 0
+	if err := integration.SyncSeverityMappings(settings, severities); err == nil ||
+		settings.SeverityMappings[0].ThreadfixIntValue != 0 {
+		t.Errorf("Expected no changes when a severity does not exist, got %+v (%v)", settings.SeverityMappings, err)
+	}
+}
@@ -0,0 +1,168 @@
+package test
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/insightappsec"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/threadfix"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/integration"
+)
+
+// Stand in for InsightAppSec serving numVulns vulnerabilities of a scan a page at a time; the page at failPage fails
+func insightAppSecVulnsStandIn(numVulns int, failPage int) *httptest.Server {
+	return httptest.NewServer(insightAppSecVulnsStandInMux(numVulns, failPage))
+}
+
+func insightAppSecVulnsStandInMux(numVulns int, failPage int) *http.ServeMux {
+	mux := insightAppSecStandInMux()
+	mux.HandleFunc("/us/ias/v1/search", func(w http.ResponseWriter, r *http.Request) {
+		index, _ := strconv.Atoi(r.URL.Query().Get("index"))
+		size, _ := strconv.Atoi(r.URL.Query().Get("size"))
+		if index == failPage {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"message": "Internal Server Error"}`)
+			return
+		}
+
+		var vulns []string
+		for id := index * size; id < numVulns && id < (index+1)*size; id++ {
+			vulns = append(vulns, fmt.Sprintf(`{"id": "vuln-%d", "severity": "HIGH", "variances": `+
+				`[{"module": {"id": "b6f559d3-74b5-451e-b424-a1c1fb264fa6"}, "attack": {"id": "1"}}]}`, id))
+		}
+		fmt.Fprintf(w, `{"data": [%s], "metadata": {"index": %d, "size": %d, "total_data": %d}}`,
+			strings.Join(vulns, ","), index, size, numVulns)
+	})
+	return mux
+}
+
+// Stand in for Threadfix accepting scan uploads, recording the scan files it received in order; zip archives are
+// unpacked
+func threadfixUploadStandIn(received *[]threadfix.ThreadfixScan, receivedErr *error) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var scan threadfix.ThreadfixScan
+		file, header, err := r.FormFile("file")
+		if err == nil && strings.HasSuffix(header.Filename, ".zip") {
+			var archive *zip.Reader
+			archive, err = zip.NewReader(file, header.Size)
+			if err == nil && len(archive.File) == 1 {
+				var entry io.ReadCloser
+				if entry, err = archive.File[0].Open(); err == nil {
+					err = json.NewDecoder(entry).Decode(&scan)
+				}
+			}
+		} else if err == nil {
+			err = json.NewDecoder(file).Decode(&scan)
+		}
+		if *receivedErr = err; err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		*received = append(*received, scan)
+		fmt.Fprint(w, `{"message": "", "success": true, "responseCode": -1, "object": "Scan queued"}`)
+	}))
+}
+
+func TestUploadScanStream(t *testing.T) {
+	var scan = insightappsec.Scan{ID: "3113af46-29cb-4f93-92e5-eddfbac4ed2c", Status: "COMPLETE",
+		SubmitTime: "2019-10-16T15:00:00.000", CompletionTime: "2019-10-16T16:00:00.000"}
+	var threadfixApp threadfix.Application
+	threadfixApp.AppData.ID = 7
+	// Several pages of vulnerabilities are streamed into the scan files
+	var numVulns = 2*insightappsec.PageSize + 1
+
+	for _, test := range []struct {
+		upload   integration.UploadConf
+		failPage int
+		uploaded bool
+		numFiles int
+	}{
+		{failPage: -1, uploaded: true, numFiles: 1},
+		{failPage: 1, uploaded: false, numFiles: 0},
+		// A failed first page is not an empty scan
+		{failPage: 0, uploaded: false, numFiles: 0},
+		{upload: integration.UploadConf{Mode: "compress"}, failPage: -1, uploaded: true, numFiles: 1},
+		{upload: integration.UploadConf{Mode: "compress"}, failPage: 1, uploaded: false, numFiles: 0},
+	} {
+		ias := insightAppSecVulnsStandIn(numVulns, test.failPage)
+		var received []threadfix.ThreadfixScan
+		var receivedErr error
+		tf := threadfixUploadStandIn(&received, &receivedErr)
+		restore := useStandIns(ias.URL, tf.URL)
+
+		uploaded := integration.UploadScan(threadfixApp, scan, integration.ExportConfiguration{Upload: test.upload})
+		if uploaded != test.uploaded {
+			t.Errorf("%+v: expected uploaded to be %t when page %d fails", test.upload, test.uploaded, test.failPage)
+		}
+		// An aborted upload reaches Threadfix as a truncated scan file, if at all
+		if test.uploaded && receivedErr != nil {
+			t.Errorf("%+v: expected valid scan files, got %s", test.upload, receivedErr)
+		}
+		if len(received) != test.numFiles {
+			t.Errorf("%+v: expected %d scan file(s), got %d", test.upload, test.numFiles, len(received))
+		}
+
+		var findings []threadfix.Finding
+		for _, threadfixScan := range received {
+			if threadfixScan.Source != threadfix.ScannerSource || threadfixScan.Updated != received[0].Updated {
+				t.Errorf("%+v: expected every scan file to share the scan details, got %+v", test.upload,
+					threadfixScan)
+			}
+			findings = append(findings, threadfixScan.Findings...)
+		}
+		if test.uploaded {
+			if len(findings) != numVulns || findings[numVulns-1].NativeID != "vuln-1000" {
+				t.Errorf("%+v: expected %d findings in order, got %d", test.upload, numVulns, len(findings))
+			} else if findings[0].Summary != "SQL Injection" {
+				t.Errorf("%+v: expected converted findings, got %+v", test.upload, findings[0])
+			}
+		}
+
+		restore()
+		ias.Close()
+		tf.Close()
+	}
+}
+
+func TestUploadSlowerThanThreadfixTimeout(t *testing.T) {
+	var scan = insightappsec.Scan{ID: "3113af46-29cb-4f93-92e5-eddfbac4ed2c", Status: "COMPLETE",
+		SubmitTime: "2019-10-16T15:00:00.000", CompletionTime: "2019-10-16T16:00:00.000"}
+	var threadfixApp threadfix.Application
+	threadfixApp.AppData.ID = 7
+	var numVulns = 3*insightappsec.PageSize + 1
+
+	// Paging through the vulnerabilities takes longer than the Threadfix timeout, though no single request does
+	mux := insightAppSecVulnsStandInMux(numVulns, -1)
+	ias := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/search") {
+			time.Sleep(400 * time.Millisecond)
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	defer ias.Close()
+	var received []threadfix.ThreadfixScan
+	var receivedErr error
+	tf := threadfixUploadStandIn(&received, &receivedErr)
+	defer tf.Close()
+	defer useStandIns(ias.URL, tf.URL)()
+	integration.ThreadfixClient.APIClient.Config.RestyClient.SetTimeout(time.Second)
+
+	start := time.Now()
+	if !integration.UploadScan(threadfixApp, scan, integration.ExportConfiguration{}) {
+		t.Fatalf("Expected the scan to be uploaded within the Threadfix timeout, got %s", receivedErr)
+	}
+	if time.Since(start) < time.Second {
+		t.Errorf("Expected paging InsightAppSec to outlast the Threadfix timeout, took %s", time.Since(start))
+	}
+	if len(received) != 1 || len(received[0].Findings) != numVulns {
+		t.Errorf("Expected one scan file of %d findings, got %d scan file(s)", numVulns, len(received))
+	}
+}
@@ -0,0 +1,98 @@
+package test
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/insightappsec"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/threadfix"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/shared"
+)
+
+func TestThreadfixFormatUrl(t *testing.T) {
+	urls := map[threadfix.ThreadfixConfiguration]string{
+		{Host: "https://threadfix.example.com", Port: "8443"}:                  "https://threadfix.example.com:8443/threadfix/rest/latest/severities",
+		{Host: "https://threadfix.example.com"}:                                "https://threadfix.example.com/threadfix/rest/latest/severities",
+		{Host: "ignored", Port: "1", BaseURL: "https://appsec.example.com/tf"}: "https://appsec.example.com/tf/rest/latest/severities",
+		{BaseURL: "https://appsec.example.com/tf/"}:                            "https://appsec.example.com/tf/rest/latest/severities",
+	}
+
+	for config, expected := range urls {
+		api := threadfix.API{Config: config}
+		if url := api.FormatUrl("rest/latest/severities"); url != expected {
+			t.Errorf("Expected %s, got %s", expected, url)
+		}
+	}
+}
+
+func TestNewRestyClient(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// The test server's certificate is only trusted with the CA bundle
+	caBundle, err := ioutil.TempFile("", "ca-bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(caBundle.Name())
+	pem.Encode(caBundle, &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	caBundle.Close()
+
+	client, err := shared.NewRestyClient(shared.TransportConfiguration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.R().Get(server.URL); err == nil {
+		t.Error("Expected an untrusted certificate error without the CA bundle")
+	}
+
+	client, err = shared.NewRestyClient(shared.TransportConfiguration{CABundle: caBundle.Name()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response, err := client.R().Get(server.URL); err != nil || response.StatusCode() != http.StatusOK {
+		t.Errorf("Expected request trusted by the CA bundle to succeed, got %v", err)
+	}
+
+	client, err = shared.NewRestyClient(shared.TransportConfiguration{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.R().Get(server.URL); err != nil {
+		t.Errorf("Expected request skipping verification to succeed, got %v", err)
+	}
+
+	for _, invalid := range []shared.TransportConfiguration{
+		{Proxy: "proxy.example.com"},
+		{ClientCertificate: caBundle.Name()},
+		{CABundle: caBundle.Name() + ".missing"},
+	} {
+		if _, err := shared.NewRestyClient(invalid); err == nil {
+			t.Errorf("Expected an error for %+v", invalid)
+		}
+	}
+}
+
+func TestInsightAppSecBaseUrl(t *testing.T) {
+	urls := map[string]string{
+		"": "https://eu.api.insight.rapid7.com/ias/v1/",
+		"https://gateway.example.com/{region}/ias/v1":   "https://gateway.example.com/eu/ias/v1/",
+		"https://gateway.example.com/insightappsec/v1/": "https://gateway.example.com/insightappsec/v1/",
+		"https://%s.gateway.example.com/ias/v1/":        "https://eu.gateway.example.com/ias/v1/",
+		// Escaped characters are not format verbs
+		"https://gateway.example.com/ias%2Fv1/%s/": "https://gateway.example.com/ias%2Fv1/eu/",
+		"https://gateway.example.com/%2F{region}":  "https://gateway.example.com/%2Feu/",
+	}
+
+	for basePath, expected := range urls {
+		if url := insightappsec.BaseUrl(basePath, "eu"); url != expected {
+			t.Errorf("Expected %s for %q, got %s", expected, basePath, url)
+		}
+	}
+}
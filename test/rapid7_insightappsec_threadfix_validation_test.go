@@ -0,0 +1,128 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/integration"
+)
+
+func TestValidateConfiguration(t *testing.T) {
+	settings := &integration.SettingsConf{
+		Connections: integration.ConnectionsConf{
+			InsightAppSec: integration.InsightAppSecConnection{Region: "us", Apikey: "insightappsec-key"},
+			Threadfix: integration.ThreadfixConnection{Host: "127.0.0.1", Port: "8443", Apikey: "threadfix-key",
+				APIVersion: "3.0"},
+		},
+		ExportConfigurations: []integration.ExportConfiguration{
+			{Name: "Hackazon Import", ApplicationScope: "Hackazon(", ScanConfigFilter: ".*",
+				Upload:    integration.UploadConf{Mode: "split"},
+				Redaction: integration.RedactionConf{Patterns: []string{"token=("}},
+				Metadata: integration.MetadataConf{
+					Scan: []integration.MetadataTemplate{{Key: "Scan", Template: "{{.ScanName}}"}}},
+				Filters: integration.FilterConf{MinSeverity: "SEVERE"}},
+		},
+		SeverityMappings: []integration.SeverityMapping{
+			{InsightAppSec: "SAFE", Threadfix: "Info"},
+			{InsightAppSec: "INFORMATIONAL", Threadfix: "Low"},
+			{InsightAppSec: "LOW", Threadfix: "Medium"},
+			{InsightAppSec: "MEDIUM", Threadfix: "High"},
+		},
+		UnmappedSeverity:  integration.UnmappedSeverityConf{Policy: "ignore"},
+		CWEMappings:       []integration.CWEMapping{{Module: "b6f559d3-74b5-451e-b424-a1c1fb264fa6", CWE: "SQLi"}},
+		InternalScheduler: "*/5 * * *",
+		Logging:           integration.LoggingConf{Level: "info"},
+	}
+
+	var settingsWithErrors []string
+	for _, validationError := range integration.ValidateConfiguration(settings) {
+		settingsWithErrors = append(settingsWithErrors, validationError.Setting)
+		// Split uploads were dropped; the error points to compressed uploads instead
+		if strings.HasSuffix(validationError.Setting, ".upload.mode") &&
+			!strings.Contains(validationError.Message, "compress") {
+			t.Errorf("Expected split uploads to suggest compressed uploads, got %s", validationError.Message)
+		}
+	}
+
+	for _, expected := range []string{
+		"connections.threadfix.host",
+		"connections.threadfix.api_version",
+		"internalScheduler",
+		"unmappedSeverity.policy",
+		"cweMappings[0]",
+		"exportConfigurations[Hackazon Import].application_scope",
+		"exportConfigurations[Hackazon Import].threadfix_team_name",
+		"exportConfigurations[Hackazon Import].threadfix_application_name",
+		"exportConfigurations[Hackazon Import].upload.mode",
+		"exportConfigurations[Hackazon Import].redaction.patterns",
+		"exportConfigurations[Hackazon Import].metadata.scan",
+		"exportConfigurations[Hackazon Import].filters.min_severity",
+	} {
+		if !strings.Contains(strings.Join(settingsWithErrors, "\n"), expected) {
+			t.Errorf("Expected a validation error for %s, got %v", expected, settingsWithErrors)
+		}
+	}
+	if len(settingsWithErrors) != 12 {
+		t.Errorf("Expected 12 validation errors, got %v", settingsWithErrors)
+	}
+
+	// The default policy needs a severity to upload unmapped findings with
+	settings.UnmappedSeverity = integration.UnmappedSeverityConf{Policy: "default"}
+	var defaultErrors []string
+	for _, validationError := range integration.ValidateConfiguration(settings) {
+		defaultErrors = append(defaultErrors, validationError.Setting)
+	}
+	if !strings.Contains(strings.Join(defaultErrors, "\n"), "unmappedSeverity.default") {
+		t.Errorf("Expected a validation error for unmappedSeverity.default, got %v", defaultErrors)
+	}
+
+	// A partial mapping is only an error when unmapped severities fail the upload
+	for policy, reported := range map[string]bool{"skip": false, "default": false, "fail": true} {
+		settings.UnmappedSeverity = integration.UnmappedSeverityConf{Policy: policy, Default: "Medium"}
+		var unmappedReported bool
+		for _, validationError := range integration.ValidateConfiguration(settings) {
+			unmappedReported = unmappedReported || validationError.Setting == "severityMappings"
+		}
+		if unmappedReported != reported {
+			t.Errorf("Expected the unmapped HIGH severity to be reported %t under the %s policy", reported, policy)
+		}
+	}
+}
+
+func TestValidateInsightAppSecRegion(t *testing.T) {
+	connection := integration.InsightAppSecConnection{Region: "mars", Apikey: "insightappsec-key"}
+	if !hasValidationError(connection, "connections.insightappsec.region") {
+		t.Error("Expected an unsupported region to be reported")
+	}
+
+	// The region is only used when the base URL includes it
+	connection.BaseURL = "https://gateway.example.com/ias/v1/"
+	if hasValidationError(connection, "connections.insightappsec.region") {
+		t.Error("Expected the region to be ignored by a base URL without the region placeholder")
+	}
+	connection.BaseURL = "gateway.example.com/{region}/ias/v1/"
+	if !hasValidationError(connection, "connections.insightappsec.base_url") {
+		t.Error("Expected a base URL without a scheme to be reported")
+	}
+}
+
+func TestValidateThreadfixDefaultPort(t *testing.T) {
+	// Without a port Threadfix is reached on the default port of the host's scheme
+	settings := &integration.SettingsConf{Connections: integration.ConnectionsConf{
+		Threadfix: integration.ThreadfixConnection{Host: "https://threadfix.example.com", Apikey: "threadfix-key"}}}
+	for _, validationError := range integration.ValidateConfiguration(settings) {
+		if strings.HasPrefix(validationError.Setting, "connections.threadfix") {
+			t.Errorf("Expected a Threadfix host without a port to be valid, got %v", validationError)
+		}
+	}
+}
+
+func hasValidationError(connection integration.InsightAppSecConnection, setting string) bool {
+	settings := &integration.SettingsConf{Connections: integration.ConnectionsConf{InsightAppSec: connection}}
+	for _, validationError := range integration.ValidateConfiguration(settings) {
+		if validationError.Setting == setting {
+			return true
+		}
+	}
+	return false
+}
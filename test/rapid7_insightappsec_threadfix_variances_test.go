@@ -0,0 +1,125 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/insightappsec"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/threadfix"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/integration"
+)
+
+// A vulnerability whose variances are listed least preferred first
+const variancesVulnerability = `{"id": "vuln-1", "severity": "HIGH", "root_cause": {"url": "http://hackazon.webscantest.com/search", "parameter": "id"},
+	"variances": [
+		{"module": {"id": "b6f559d3-74b5-451e-b424-a1c1fb264fa6"}, "attack": {"id": "3"}},
+		{"module": {"id": "b6f559d3-74b5-451e-b424-a1c1fb264fa6"}, "attack": {"id": "2"}, "attack_value": "1' OR '1'='1"},
+		{"module": {"id": "b6f559d3-74b5-451e-b424-a1c1fb264fa6"}, "attack": {"id": "1"}, "attack_value": "1;--",
+			"attack_exchanges": [{"request": "GET /search?id=1;-- HTTP/1.1", "response": "HTTP/1.1 500"}]},
+		{"module": {"id": "b6f559d3-74b5-451e-b424-a1c1fb264fa6"}, "attack": {"id": "3"}}
+	]}`
+
+func TestSortVariances(t *testing.T) {
+	var first, second insightappsec.Variance
+	first.Attack.ID = "1"
+	second.Attack.ID = "2"
+	second.AttackValue = "1;--"
+
+	var confidence = func(moduleId string) string { return "" }
+	for _, variances := range [][]insightappsec.Variance{{first, second}, {second, first}} {
+		if preferred := integration.PreferredVariance(variances, confidence); preferred.Attack.ID != "2" {
+			t.Errorf("Expected the variance with an attack value to be preferred, got attack %s", preferred.Attack.ID)
+		}
+	}
+
+	// A more confident module outranks an attack value, but not an attack request
+	first.Module.ID = "confident"
+	confidence = func(moduleId string) string {
+		if moduleId == "confident" {
+			return "high"
+		}
+		return "LOW"
+	}
+	var preferred = integration.PreferredVariance([]insightappsec.Variance{second, first}, confidence)
+	if preferred.Attack.ID != "1" {
+		t.Errorf("Expected the variance of the most confident module to be preferred, got attack %s", preferred.Attack.ID)
+	}
+	json.Unmarshal([]byte(`{"attack_exchanges": [{"request": "GET /search?id=1;-- HTTP/1.1"}]}`), &second)
+	preferred = integration.PreferredVariance([]insightappsec.Variance{first, second}, confidence)
+	if preferred.Attack.ID != "2" {
+		t.Errorf("Expected the variance with an attack request to be preferred, got attack %s", preferred.Attack.ID)
+	}
+
+	if integration.VarianceNativeID("vuln-1", first) != integration.VarianceNativeID("vuln-1", first) ||
+		integration.VarianceNativeID("vuln-1", first) == integration.VarianceNativeID("vuln-1", second) {
+		t.Error("Expected native IDs to be stable and distinct for each variance")
+	}
+}
+
+func TestConvertVariances(t *testing.T) {
+	mux := insightAppSecStandInMux()
+	mux.HandleFunc("/us/ias/v1/search", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"data": [%s], "metadata": {"total_data": 1}}`, variancesVulnerability)
+	})
+	ias := httptest.NewServer(mux)
+	defer ias.Close()
+
+	var received []threadfix.ThreadfixScan
+	var receivedErr error
+	tf := threadfixUploadStandIn(&received, &receivedErr)
+	defer tf.Close()
+
+	defer useStandIns(ias.URL, tf.URL)()
+
+	for _, test := range []struct {
+		variances   string
+		numFindings int
+	}{
+		{variances: "", numFindings: 1},
+		{variances: "details", numFindings: 1},
+		// The duplicate variance is a single finding
+		{variances: "findings", numFindings: 3},
+	} {
+		received = nil
+		scan := insightappsec.Scan{ID: "3113af46-29cb-4f93-92e5-eddfbac4ed2c"}
+		if !integration.UploadScan(threadfix.Application{}, scan, integration.ExportConfiguration{Variances: test.variances}) {
+			t.Fatalf("%s: expected scan to be uploaded: %v", test.variances, receivedErr)
+		}
+		findings := received[0].Findings
+		if len(findings) != test.numFindings {
+			t.Fatalf("%s: expected %d finding(s), got %d", test.variances, test.numFindings, len(findings))
+		}
+
+		// The preferred variance comes first; it keeps the vulnerability's ID unless each variance is a finding
+		preferred := findings[0]
+		if preferred.NativeID != "vuln-1" && test.variances != "findings" ||
+			preferred.DynamicDetails.SurfaceLocation.AttackString != "1;--" {
+			t.Errorf("%s: expected the variance with an attack request first, got %+v", test.variances, preferred)
+		}
+
+		switch test.variances {
+		case "details":
+			if preferred.Metadata["Variance 4"] == "" || preferred.Metadata["Variance 5"] != "" ||
+				preferred.Metadata["Variance 2"] != "Module: SQL Injection; Attack: 2; Attack Value: 1' OR '1'='1" {
+				t.Errorf("Expected the other variances in metadata, got %v", preferred.Metadata)
+			}
+		case "findings":
+			// Every variance's native ID is derived the same way, whichever variance is preferred
+			var nativeIds = make(map[string]bool)
+			for _, finding := range findings {
+				nativeIds[finding.NativeID] = true
+			}
+			var variance insightappsec.Variance
+			variance.Module.ID = "b6f559d3-74b5-451e-b424-a1c1fb264fa6"
+			variance.Attack.ID = "1"
+			variance.AttackValue = "1;--"
+			if len(nativeIds) != len(findings) || nativeIds["vuln-1"] ||
+				preferred.NativeID != integration.VarianceNativeID("vuln-1", variance) {
+				t.Errorf("Expected distinct derived native IDs, got %v", nativeIds)
+			}
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/components/threadfix"
+	"github.com/rapid7/strategic-integrations/appsec/rapid7-insightappsec-threadfix/pkg/shared"
+)
+
+// Stand in for a Threadfix server, answering the paths listed in fixtures/threadfix/<server>/routes.json with the
+// response files next to it; every other path is not found
+func threadfixStandIn(server string) *httptest.Server {
+	var routes map[string]string
+	routesJson, err := ioutil.ReadFile(filepath.Join("fixtures", "threadfix", server, "routes.json"))
+	if err == nil {
+		err = json.Unmarshal(routesJson, &routes)
+	}
+	if err != nil {
+		panic(fmt.Sprintf("unable to read routes of Threadfix fixture %s: %s", server, err))
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fixture, ok := routes[strings.TrimPrefix(r.URL.RequestURI(), "/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, err := ioutil.ReadFile(filepath.Join("fixtures", "threadfix", server, fixture))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+}
+
+func threadfixStandInClient(url string) threadfix.API {
+	var apiClient = shared.APIClient{Config: shared.APIConfiguration{Timeout: 30, RestyClient: resty.New()}}
+	return threadfix.API{Config: threadfix.ThreadfixConfiguration{BaseURL: url, APIKey: "threadfix-test-key"},
+		APIClient: apiClient}
+}
+
+func TestThreadfixCompatibilityMatrix(t *testing.T) {
+	for _, test := range []struct {
+		server  string
+		version string
+	}{
+		// A server answering the endpoints used before negotiation keeps them, though it also answers the latest
+		// severities
+		{server: "mixed", version: "mixed"},
+		{server: "latest", version: "latest"},
+		{server: "2.5", version: "2.5"},
+		{server: "legacy", version: "legacy"},
+	} {
+		server := threadfixStandIn(test.server)
+		api := threadfixStandInClient(server.URL)
+
+		if err := api.NegotiateVersion(threadfix.APIVersionAuto); err != nil {
+			t.Errorf("%s: expected version to be detected, got %s", test.server, err)
+			server.Close()
+			continue
+		}
+		endpoints := *api.Endpoints
+		if endpoints.Version != test.version {
+			t.Errorf("%s: expected version %s, detected %s", test.server, test.version, endpoints.Version)
+		}
+
+		app, err := api.GetAppByName("AppSec", "Hackazon")
+		if err != nil || app.AppData.ID != 7 {
+			t.Errorf("%s: expected application 7, got %d (%v)", endpoints.Version, app.AppData.ID, err)
+		}
+
+		scans, err := api.ListScans(app.AppData.ID)
+		if err != nil || len(scans) != 1 || scans[0].ID != 11 {
+			t.Errorf("%s: expected only the InsightAppSec scan, got %+v (%v)", endpoints.Version, scans, err)
+		}
+
+		upload, err := api.UploadScan(app.AppData.ID, threadfix.ThreadfixScan{ExecutiveSummary: "scan"})
+		if err != nil || !upload.Success {
+			t.Errorf("%s: expected upload to succeed, got %+v (%v)", endpoints.Version, upload, err)
+		}
+
+		severities, err := api.ListSeverities()
+		if endpoints.Severities == "" {
+			if err == nil {
+				t.Errorf("%s: expected severities to be unsupported", endpoints.Version)
+			}
+		} else if err != nil || len(severities.SeveritiesMetadata) != 5 {
+			t.Errorf("%s: expected 5 severities, got %+v (%v)", endpoints.Version, severities, err)
+		}
+
+		server.Close()
+	}
+}
+
+func TestThreadfixVersionOverride(t *testing.T) {
+	server := threadfixStandIn("legacy")
+	defer server.Close()
+	api := threadfixStandInClient(server.URL)
+
+	if err := api.NegotiateVersion("2.5"); err != nil || api.Endpoints.Version != "2.5" {
+		t.Errorf("Expected configured version 2.5 to be selected without detection, got %v", err)
+	}
+	if err := api.NegotiateVersion("1.0"); err == nil {
+		t.Error("Expected an error for an unknown API version")
+	}
+}
+
+func TestThreadfixVersionErrors(t *testing.T) {
+	unauthorized := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer unauthorized.Close()
+	api := threadfixStandInClient(unauthorized.URL)
+	if err := api.NegotiateVersion(""); err == nil || !strings.Contains(err.Error(), "API key") {
+		t.Errorf("Expected the API key to be reported as rejected, got %v", err)
+	}
+
+	// A server that is not Threadfix, such as a login page, supports no version
+	loginPage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>Login</html>"))
+	}))
+	defer loginPage.Close()
+	api = threadfixStandInClient(loginPage.URL)
+	if err := api.NegotiateVersion(""); err == nil || !strings.Contains(err.Error(), "does not support") {
+		t.Errorf("Expected no supported API version, got %v", err)
+	}
+}